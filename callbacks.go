@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cznic/cc"
+	"github.com/cznic/xc"
+)
+
+// callbacksPreamble turns a cgo.Handle into the void * user data handed to
+// C, which go vet would not let the Go side do. Like the prototypes of the
+// trampolines, it goes to the preamble of every file calling it.
+const callbacksPreamble = `#include <stdint.h>
+static void *cgogen_handle(uintptr_t h) { return (void *)h; }
+`
+
+// Callback is a C function pointer type Go functions are passed as. The Go
+// function is registered as a cgo.Handle, which C hands back to an exported
+// trampoline through the user data parameter.
+type Callback struct {
+	identifier string
+	goName     string
+	Parameters []Parameter
+	ResultType Type
+
+	// userdata is the index of the void * parameter carrying the handle.
+	userdata int
+}
+
+func (cb Callback) CName() string { return cb.identifier }
+
+// parseCallback returns the callback of the function pointer type t, false
+// if it has no void * parameter to hand back the handle.
+func parseCallback(identifier, goName string, t cc.Type) (Callback, bool) {
+	fn := t.Element()
+	cb := Callback{
+		identifier: identifier,
+		goName:     goName,
+		ResultType: Type{fn.Result()},
+		userdata:   -1,
+	}
+	params, _ := fn.Parameters()
+	for _, p := range params {
+		pt := p.Type
+		if p.Declarator != nil {
+			pt = p.Declarator.Type
+		}
+		if pt.Kind() == cc.Void {
+			continue
+		}
+		if cb.userdata < 0 && isUserdata(pt) {
+			cb.userdata = len(cb.Parameters)
+		}
+		identifier := ""
+		if p.Name > 0 {
+			identifier = blessName(xc.Dict.S(p.Name))
+		}
+		cb.Parameters = append(cb.Parameters, Parameter{identifier: identifier, Type: Type{pt}})
+	}
+	return cb, cb.userdata >= 0
+}
+
+// isUserdata reports whether t is a plain void * as used for user data.
+func isUserdata(t cc.Type) bool {
+	return t.Kind() == cc.Ptr && t.Element().Kind() == cc.Void && typedefNameOf(t) == ""
+}
+
+// callbackSet collects the callbacks taken by the generated functions.
+type callbackSet struct {
+	list  []Callback
+	known map[string]bool
+}
+
+// add adds cb unless it is known already and reports whether cb can be
+// generated.
+func (s *callbackSet) add(cb Callback, namer Namer) bool {
+	if s.known == nil {
+		s.known = make(map[string]bool)
+	}
+	if ok, known := s.known[cb.identifier]; known {
+		return ok
+	}
+	ok := cb.ResultType.CType(namer) != ""
+	for _, p := range cb.Parameters {
+		ok = ok && p.Type.CType(namer) != ""
+	}
+	s.known[cb.identifier] = ok
+	if ok {
+		s.list = append(s.list, cb)
+	}
+	return ok
+}
+
+// bindCallbacks lets w take a Go function for the first function pointer
+// parameter of f that comes with a void * user data parameter and returns
+// its callback, false if there is none. The handle of the Go function is
+// deleted when the call returns unless retain is set, then it is returned
+// for the caller to delete once C no longer calls back.
+func bindCallbacks(w *wrapper, f Function, namer Namer, set *callbackSet, retain bool) (Callback, bool) {
+	userdata := -1
+	for i, p := range f.Parameters {
+		if isUserdata(p.Type.Type) {
+			userdata = i
+			break
+		}
+	}
+	if userdata < 0 {
+		return Callback{}, false
+	}
+
+	for i, p := range f.Parameters {
+		if !isProcType(p.Type.Type) {
+			continue
+		}
+		identifier := p.Type.typedefName(namer)
+		goName := namer.TypedefName(Typedef{identifier: identifier})
+		if identifier == "" {
+			identifier = f.CName() + "_" + p.CName()
+			goName = w.name + Export(namer.ParameterName(p)) + "Func"
+		}
+		cb, ok := parseCallback(identifier, goName, p.Type.Type)
+		if !ok || !set.add(cb, namer) {
+			continue
+		}
+
+		name := namer.ParameterName(p)
+		fn, data, handle := name+"Fn", name+"Data", name+"Handle"
+		w.param(i).goType = goName
+		w.dropParam(userdata)
+		w.args[i] = fn
+		w.args[userdata] = data
+
+		setup := &strings.Builder{}
+		fmt.Fprintf(setup, "var %s %s\n", fn, p.Type.CGoType(namer))
+		fmt.Fprintf(setup, "var %s unsafe.Pointer\n", data)
+		if retain {
+			fmt.Fprintf(setup, "var %s cgo.Handle\n", handle)
+		}
+		fmt.Fprintf(setup, "if %s != nil {\n", name)
+		if retain {
+			fmt.Fprintf(setup, "\t%s = cgo.NewHandle(%s)\n", handle, name)
+		} else {
+			fmt.Fprintf(setup, "\t%s := cgo.NewHandle(%s)\n", handle, name)
+			fmt.Fprintf(setup, "\tdefer %s.Delete()\n", handle)
+		}
+		fmt.Fprintf(setup, "\t%s = (%s)(C.cgogen_cb_%s)\n", fn, p.Type.CGoType(namer), identifier)
+		fmt.Fprintf(setup, "\t%s = C.cgogen_handle(C.uintptr_t(%s))\n", data, handle)
+		fmt.Fprintf(setup, "}")
+		w.setup = append(w.setup, setup.String())
+		if retain {
+			w.addResult(wrapperResult{goType: "cgo.Handle", zero: "0", expr: handle})
+		}
+		return cb, true
+	}
+	return Callback{}, false
+}
+
+// goParamTypes returns the Go types of the parameters the Go function of cb
+// takes, which are all but the user data.
+func (cb Callback) goParamTypes(namer Namer) []string {
+	types := make([]string, 0, len(cb.Parameters))
+	for i, p := range cb.Parameters {
+		if i != cb.userdata {
+			types = append(types, p.Type.GoType(namer))
+		}
+	}
+	return types
+}
+
+// emitCallback writes the Go function type of cb to o.
+func emitCallback(cb Callback, o io.Writer, namer Namer) {
+	fmt.Fprintf(o, "type %s func(%s)", cb.goName, strings.Join(cb.goParamTypes(namer), ", "))
+	if cb.ResultType.Kind() != cc.Void {
+		fmt.Fprintf(o, " %s", cb.ResultType.GoType(namer))
+	}
+	fmt.Fprintf(o, "\n")
+}
+
+// callbackPrototype returns the prototype of the exported trampoline of cb
+// for the preamble of the wrappers passing it to C.
+func callbackPrototype(cb Callback, namer Namer) string {
+	cParams := make([]string, len(cb.Parameters))
+	for i, p := range cb.Parameters {
+		cParams[i] = fmt.Sprintf("%s p%d", p.Type.CType(namer), i)
+	}
+	return fmt.Sprintf("extern %s cgogen_cb_%s(%s);\n", cb.ResultType.CType(namer), cb.identifier, strings.Join(cParams, ", "))
+}
+
+// emitCallbackExport writes the trampoline of cb, which calls the Go
+// function registered with the handle it is passed as user data. It has to
+// go to a file of its own, as cgo allows no C definitions in the preamble
+// of files exporting functions.
+func emitCallbackExport(cb Callback, o io.Writer, namer Namer) {
+	name := "cgogen_cb_" + cb.identifier
+	fmt.Fprintf(o, "//export %s\n", name)
+	fmt.Fprintf(o, "func %s(\n", name)
+	for i, p := range cb.Parameters {
+		fmt.Fprintf(o, "\tp%d %s,\n", i, p.Type.CGoType(namer))
+	}
+	if cb.ResultType.Kind() == cc.Void {
+		fmt.Fprintf(o, ")")
+	} else {
+		fmt.Fprintf(o, ") %s", cb.ResultType.CGoType(namer))
+	}
+	fmt.Fprintf(o, " {\n")
+	fmt.Fprintf(o, "\t")
+	if cb.ResultType.Kind() != cc.Void {
+		fmt.Fprintf(o, "ret := ")
+	}
+	fmt.Fprintf(o, "cgo.Handle(uintptr(p%d)).Value().(%s)(\n", cb.userdata, cb.goName)
+	for i, p := range cb.Parameters {
+		if i != cb.userdata {
+			fmt.Fprintf(o, "\t\t%s,\n", goResult(fmt.Sprintf("p%d", i), p.Type, namer))
+		}
+	}
+	fmt.Fprintf(o, "\t)\n")
+	if cb.ResultType.Kind() != cc.Void {
+		fmt.Fprintf(o, "\treturn %s\n", cgoArg("ret", cb.ResultType, namer))
+	}
+	fmt.Fprintf(o, "}\n")
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// defaultArch is the GOARCH used when a package does not name any.
+const defaultArch = "amd64"
+
+// Manifest lists every binding package produced by one generator run.
+type Manifest struct {
+	Packages []*PackageConfig `json:"packages"`
+}
+
+// PackageConfig describes a single Go binding package to generate.
+type PackageConfig struct {
+	Headers      []string `json:"headers"`
+	Package      string   `json:"package"`
+	Output       string   `json:"output"`
+	Arches       []string `json:"arches"`
+	Naming       Naming   `json:"naming"`
+	Include      []string `json:"include"`
+	Exclude      []string `json:"exclude"`
+	IncludeFiles []string `json:"include_files"`
+	ExcludeFiles []string `json:"exclude_files"`
+	IncludePaths []string `json:"include_paths"`
+	Defines      []string `json:"defines"`
+	CFlags       []string `json:"cflags"`
+	LDFlags      []string `json:"ldflags"`
+	PkgConfig    []string `json:"pkg_config"`
+
+	// Cgo holds platform specific #cgo directives of the generated preamble.
+	Cgo []CgoFlags `json:"cgo"`
+	// Includes overrides the #include lines of the generated preamble,
+	// e.g. "<VG/openvg.h>". By default they are derived from Headers.
+	Includes []string `json:"includes"`
+
+	// SysIncludePaths are searched after IncludePaths, typically for the
+	// C library headers pulled in by vendor headers.
+	SysIncludePaths []string `json:"sys_include_paths"`
+	// Predefines are C source snippets parsed before the headers, e.g. to
+	// stub out compiler extensions the parser does not understand.
+	Predefines []string `json:"predefines"`
+
+	// Loader resolves the functions declared together with a PFN*PROC
+	// typedef at run time instead of linking them: "dlopen" loads them from
+	// the first of the Library files that loads and "getprocaddress" asks
+	// the GetProcAddress function variable of the generated package. The
+	// wrappers of such functions also return an error, which is a
+	// *NotAvailableError if the entry point is missing.
+	Loader  string   `json:"loader"`
+	Library []string `json:"library"`
+
+	// RetainCallbacks are globs of the functions which keep the Go
+	// callbacks they are passed registered after they return, such as
+	// setters of log hooks. Their wrappers return the cgo.Handle of each
+	// callback for the caller to Delete once C no longer calls it.
+	RetainCallbacks []string `json:"retain_callbacks"`
+
+	// Extensions splits off the declarations guarded by "#ifndef EXT" and
+	// "#define EXT 1" into a file per extension. With "tags" the file is
+	// only built with the build tag EXT, with "runtime" the functions of
+	// the extension fail with a *NotAvailableError unless the C expression
+	// ExtensionQuery, e.g. "vgGetString(VG_EXTENSIONS)", lists EXT.
+	Extensions     string `json:"extensions"`
+	ExtensionQuery string `json:"extension_query"`
+
+	// Flags maps the enums which are sets of flags, such as VGPaintMode, to
+	// globs of the "function.parameter" that take them, e.g. "*.paintModes",
+	// where "function.return" stands for the result.
+	Flags map[string][]string `json:"flags"`
+
+	// EnumNames selects the names the String and Parse functions of enums
+	// use, "go" for the Go names (the default) or "c" for the C names.
+	EnumNames string `json:"enum_names"`
+	// EnumSentinels are globs of enum members which are no values of their
+	// own, such as VG_PAINT_MODE_FORCE_SIZE.
+	EnumSentinels []string `json:"enum_sentinels"`
+
+	// Slices make pointer parameters, such as the values of vgSetfv, take Go
+	// slices whose length is passed as their count parameter. With
+	// SliceHeuristics a pointer next to an integer parameter named like a
+	// count, e.g. count, numSegments or glyphCount, is one as well.
+	Slices          []SliceRule `json:"slices"`
+	SliceHeuristics bool        `json:"slice_heuristics"`
+
+	// OutParams make pointer parameters, such as the bounds of
+	// vgPathBounds, results of the wrappers. With OutHeuristics every
+	// non-const pointer to a scalar, which is not a slice, is one as well.
+	OutParams     []OutRule `json:"out_params"`
+	OutHeuristics bool      `json:"out_heuristics"`
+
+	// RawStrings are globs of the "function.parameter" or "function.return"
+	// whose const char pointers are not NUL-terminated strings. Every other
+	// one is taken as a Go string copied to C for the call and returned as
+	// a Go string copied from C.
+	RawStrings []string `json:"raw_strings"`
+
+	// ErrorEnums maps the enums of error codes, such as VGUErrorCode, to
+	// their success member and Go error type. The functions returning them
+	// return an error instead, see ErrorEnum.
+	ErrorEnums map[string]ErrorEnum `json:"error_enums"`
+
+	// Debug is a build tag, e.g. "vgdebug", which selects a second
+	// implementation of every function. It calls the C function
+	// DebugCheck, e.g. vgGetError, after the call and reports the function
+	// and its arguments if that returns an error code other than 0, by
+	// DebugAction "panic" (the default) or "log".
+	Debug       string `json:"debug"`
+	DebugCheck  string `json:"debug_check"`
+	DebugAction string `json:"debug_action"`
+
+	// ImportTypes are the packages of the manifest whose typedefs this one
+	// uses, such as the VGPath and VGboolean of vg in vgu. The typedefs of
+	// their headers, which this package does not declare, are their Go types
+	// rather than the underlying types.
+	ImportTypes []TypeImport `json:"import_types"`
+}
+
+// TypeImport names a package of the manifest and the Go import path of the
+// code generated for it, see PackageConfig.ImportTypes.
+type TypeImport struct {
+	Package string `json:"package"`
+	Path    string `json:"path"`
+
+	// cfg is the package, resolved by LoadManifest.
+	cfg *PackageConfig
+}
+
+// Names of enum members, see PackageConfig.EnumNames.
+const (
+	enumNamesGo = "go"
+	enumNamesC  = "c"
+)
+
+func LoadManifest(manifestPath string) (*Manifest, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", manifestPath, err)
+	}
+	if len(m.Packages) == 0 {
+		return nil, fmt.Errorf("%s: no packages defined", manifestPath)
+	}
+
+	// Paths in the manifest are relative to the manifest itself:
+	dir := filepath.Dir(manifestPath)
+	for _, p := range m.Packages {
+		if len(p.Arches) == 0 {
+			p.Arches = []string{defaultArch}
+		}
+		p.Output = relativeTo(dir, p.Output)
+		for i := range p.Headers {
+			p.Headers[i] = relativeTo(dir, p.Headers[i])
+		}
+		for i := range p.IncludePaths {
+			p.IncludePaths[i] = relativeTo(dir, p.IncludePaths[i])
+		}
+		// Headers are searched next to the manifest by default, rather than
+		// in the working directory:
+		if len(p.IncludePaths) == 0 {
+			p.IncludePaths = []string{dir}
+		}
+		for i := range p.SysIncludePaths {
+			p.SysIncludePaths[i] = relativeTo(dir, p.SysIncludePaths[i])
+		}
+	}
+	for _, p := range m.Packages {
+		for i, imp := range p.ImportTypes {
+			for _, q := range m.Packages {
+				if q.Package == imp.Package && q != p {
+					p.ImportTypes[i].cfg = q
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+func relativeTo(dir, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+func (c *PackageConfig) Validate() error {
+	if len(c.Headers) == 0 {
+		return fmt.Errorf("no headers given")
+	}
+	if c.Package == "" {
+		return fmt.Errorf("no package name given")
+	}
+	if c.Output == "" {
+		return fmt.Errorf("no output path given")
+	}
+	if len(c.Arches) == 0 {
+		return fmt.Errorf("no target architecture given")
+	}
+	seen := make(map[string]bool, len(c.Arches))
+	for _, goarch := range c.Arches {
+		if _, ok := arches[goarch]; !ok {
+			return fmt.Errorf("unknown target architecture %q", goarch)
+		}
+		// Several arches are told apart by their GOARCH:
+		if seen[goarchOf(goarch)] {
+			return fmt.Errorf("duplicate target architecture %q", goarch)
+		}
+		seen[goarchOf(goarch)] = true
+	}
+	switch c.Loader {
+	case "", loaderGetProcAddress:
+	case loaderDlopen:
+		if len(c.Library) == 0 {
+			return fmt.Errorf("no library given to dlopen")
+		}
+	default:
+		return fmt.Errorf("unknown loader %q", c.Loader)
+	}
+	switch c.Extensions {
+	case "", extensionsTags:
+	case extensionsRuntime:
+		if c.ExtensionQuery == "" {
+			return fmt.Errorf("no extension query given")
+		}
+	default:
+		return fmt.Errorf("unknown extensions mode %q", c.Extensions)
+	}
+	switch c.EnumNames {
+	case "", enumNamesGo, enumNamesC:
+	default:
+		return fmt.Errorf("unknown enum names %q", c.EnumNames)
+	}
+	if err := validFlagPatterns(c.Flags); err != nil {
+		return err
+	}
+	if err := validParamPatterns(c.RawStrings); err != nil {
+		return fmt.Errorf("raw strings: %v", err)
+	}
+	for _, r := range c.Slices {
+		_, errFunction := path.Match(r.Function, "")
+		_, errPointer := path.Match(r.Pointer, "")
+		if errFunction != nil || errPointer != nil || r.Pointer == "" || r.Count == "" || r.Stride < 0 {
+			return fmt.Errorf("bad slice rule %q: want function and pointer globs and a count", r.Function)
+		}
+	}
+	for _, r := range c.OutParams {
+		_, errFunction := path.Match(r.Function, "")
+		_, errParam := path.Match(r.Param, "")
+		if errFunction != nil || errParam != nil || r.Param == "" || r.Length < -1 {
+			return fmt.Errorf("bad output parameter rule %q: want function and parameter globs", r.Function)
+		}
+	}
+	if c.Debug != "" && c.DebugCheck == "" {
+		return fmt.Errorf("no debug check function given")
+	}
+	switch c.DebugAction {
+	case "", debugPanic, debugLog:
+	default:
+		return fmt.Errorf("unknown debug action %q", c.DebugAction)
+	}
+	for enum, rule := range c.ErrorEnums {
+		if rule.Success == "" {
+			return fmt.Errorf("no success member of error enum %s given", enum)
+		}
+	}
+	if err := c.Naming.compile(); err != nil {
+		return err
+	}
+	for _, imp := range c.ImportTypes {
+		if imp.cfg == nil {
+			return fmt.Errorf("no package %q to import types from", imp.Package)
+		}
+		if imp.Path == "" {
+			return fmt.Errorf("no import path of package %q given", imp.Package)
+		}
+		// The package may come later in the manifest:
+		if err := imp.cfg.Naming.compile(); err != nil {
+			return fmt.Errorf("package %s: %v", imp.Package, err)
+		}
+	}
+	for _, patterns := range [][]string{c.Include, c.Exclude, c.IncludeFiles, c.ExcludeFiles, c.RetainCallbacks, c.EnumSentinels} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("bad filter pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// CgoFlags are the #cgo directives for one platform, which is a build
+// constraint such as "linux,arm" or empty for every platform.
+type CgoFlags struct {
+	Platform  string   `json:"platform"`
+	CFlags    []string `json:"cflags"`
+	LDFlags   []string `json:"ldflags"`
+	PkgConfig []string `json:"pkg_config"`
+}
+
+// parseCgoDirective parses a #cgo directive body such as
+// "linux,arm LDFLAGS: -lShivaVG".
+func parseCgoDirective(directive string) (CgoFlags, error) {
+	i := strings.IndexByte(directive, ':')
+	if i < 0 {
+		return CgoFlags{}, fmt.Errorf("bad cgo directive %q: missing colon", directive)
+	}
+	fields := strings.Fields(directive[:i])
+	if len(fields) == 0 {
+		return CgoFlags{}, fmt.Errorf("bad cgo directive %q: missing CFLAGS, LDFLAGS or pkg-config", directive)
+	}
+	f := CgoFlags{Platform: strings.Join(fields[:len(fields)-1], " ")}
+	args := strings.Fields(directive[i+1:])
+	switch fields[len(fields)-1] {
+	case "CFLAGS":
+		f.CFlags = args
+	case "LDFLAGS":
+		f.LDFlags = args
+	case "pkg-config":
+		f.PkgConfig = args
+	default:
+		return CgoFlags{}, fmt.Errorf("bad cgo directive %q: unsupported %s", directive, fields[len(fields)-1])
+	}
+	return f, nil
+}
+
+// cgoDirectives returns the bodies of the #cgo lines of the preamble.
+func (c *PackageConfig) cgoDirectives() []string {
+	var lines []string
+	add := func(platform, kind string, args []string) {
+		if len(args) == 0 {
+			return
+		}
+		if platform != "" {
+			kind = platform + " " + kind
+		}
+		lines = append(lines, kind+": "+strings.Join(args, " "))
+	}
+	for _, f := range append([]CgoFlags{{CFlags: c.CFlags, LDFlags: c.LDFlags, PkgConfig: c.PkgConfig}}, c.Cgo...) {
+		add(f.Platform, "CFLAGS", f.CFlags)
+		add(f.Platform, "LDFLAGS", f.LDFlags)
+		add(f.Platform, "pkg-config", f.PkgConfig)
+	}
+	return lines
+}
+
+// preambleIncludes returns the #include arguments of the preamble. Headers
+// found below an include path are included as <dir/header.h> so that the
+// bindings build against whatever -I the cgo flags point at; any other
+// header is included relative to the generated file.
+func (c *PackageConfig) preambleIncludes() []string {
+	if len(c.Includes) > 0 {
+		includes := make([]string, len(c.Includes))
+		for i, inc := range c.Includes {
+			if !strings.HasPrefix(inc, "<") && !strings.HasPrefix(inc, "\"") {
+				inc = "<" + inc + ">"
+			}
+			includes[i] = inc
+		}
+		return includes
+	}
+
+	searchPaths := c.IncludePaths
+	if len(searchPaths) == 0 {
+		searchPaths = []string{"."}
+	}
+	outDir := filepath.Dir(c.Output)
+	includes := make([]string, 0, len(c.Headers))
+	for _, h := range c.Headers {
+		includes = append(includes, includeFor(h, searchPaths, outDir))
+	}
+	return includes
+}
+
+func includeFor(header string, searchPaths []string, outDir string) string {
+	for _, dir := range searchPaths {
+		if rel, err := filepath.Rel(dir, header); err == nil && !strings.HasPrefix(rel, "..") {
+			return "<" + filepath.ToSlash(rel) + ">"
+		}
+	}
+	if rel, err := filepath.Rel(outDir, header); err == nil {
+		header = rel
+	}
+	return "\"" + filepath.ToSlash(header) + "\""
+}
+
+// definesSource turns NAME or NAME=VALUE definitions into #define lines.
+func definesSource(defines []string) string {
+	lines := make([]string, 0, len(defines))
+	for _, d := range defines {
+		name, value := d, "1"
+		if i := strings.IndexByte(d, '='); i >= 0 {
+			name, value = d[:i], d[i+1:]
+		}
+		lines = append(lines, fmt.Sprintf("#define %s %s", name, value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// matchAny reports whether name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFile reports whether any of the glob patterns matches filename or
+// one of its trailing paths, so that "VG/vgu.h" matches /usr/include/VG/vgu.h.
+func matchFile(patterns []string, filename string) bool {
+	for {
+		if matchAny(patterns, filename) {
+			return true
+		}
+		i := strings.IndexByte(filename, '/')
+		if i < 0 {
+			return false
+		}
+		filename = filename[i+1:]
+	}
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// commaList is a stringList that also splits each value at commas.
+type commaList []string
+
+func (l *commaList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *commaList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
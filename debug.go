@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Builds of declarations which are built with or without the debug tag
+// only, see PackageConfig.Debug.
+const (
+	buildDebug   = "debug"
+	buildNoDebug = "nodebug"
+)
+
+// How the debug build reports errors, see PackageConfig.DebugAction.
+const (
+	debugPanic = "panic"
+	debugLog   = "log"
+)
+
+// debugConstraint returns the build constraint selecting the build of
+// declarations with the debug tag.
+func debugConstraint(build, tag string) string {
+	switch build {
+	case buildDebug:
+		return tag
+	case buildNoDebug:
+		return "!" + tag
+	}
+	return ""
+}
+
+// checkDebug makes w call the C function check after the C call and report
+// the error code it returns unless it is 0.
+func checkDebug(w *wrapper, check Function, namer Namer) {
+	args := []string{fmt.Sprintf("%q", w.name), goResult("code", check.ResultType, namer)}
+	for _, p := range w.params {
+		args = append(args, p.name)
+	}
+	w.check = append(w.check, fmt.Sprintf("if code := C.%s(); code != 0 {\n\tdebugError(%s)\n}", check.CName(), strings.Join(args, ", ")))
+}
+
+// debugDecl returns debugError, which reports the error code pending after
+// a call by the action, panic or log.
+func debugDecl(action string) Decl {
+	report := "panic(msg)"
+	if action == debugLog {
+		report = "log.Print(msg)"
+	}
+	return Decl{
+		Name: "debugError",
+		Source: fmt.Sprintf(`// debugError reports the error code pending after function was called with args.
+func debugError(function string, code interface{}, args ...interface{}) {
+	s := make([]string, len(args))
+	for i, arg := range args {
+		s[i] = fmt.Sprintf("%%#v", arg)
+	}
+	msg := fmt.Sprintf("%%s(%%s): %%v", function, strings.Join(s, ", "), code)
+	%s
+}
+`, report),
+		Build: buildDebug,
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	numbered := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	for _, test := range []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"change", "a\nb\nc\n", "a\nB\nc\n", `--- old
++++ new
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`},
+		{"context", numbered, strings.Replace(numbered, "5\n", "five\n", 1), `--- old
++++ new
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`},
+		{"hunks", numbered, strings.Replace(strings.Replace(numbered, "1\n", "one\n", 1), "10\n", "ten\n", 1), `--- old
++++ new
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -7,4 +7,4 @@
+ 7
+ 8
+ 9
+-10
++ten
+`},
+		{"create", "", "a\n", `--- old
++++ new
+@@ -0,0 +1,1 @@
++a
+`},
+		{"no newline", "a", "b", `--- old
++++ new
+@@ -1,1 +1,1 @@
+-a
+\ No newline at end of file
++b
+\ No newline at end of file
+`},
+	} {
+		if got := unifiedDiff("old", "new", []byte(test.old), []byte(test.new)); got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// ErrorEnum describes an enum of error codes, such as VGUErrorCode. The
+// functions returning it return an error instead, which is nil for the
+// Success member and a pointer to the Go error type Type otherwise.
+type ErrorEnum struct {
+	Success string `json:"success"`
+	Type    string `json:"type"`
+}
+
+// errorType is the Go error type of a generated error enum.
+type errorType struct {
+	name    string
+	enum    string
+	success string
+}
+
+// newErrorType returns the error type of the enum e, whose Go name defaults
+// to the enum's followed by Error.
+func newErrorType(e Enum, rule ErrorEnum, namer Namer) (errorType, error) {
+	t := errorType{name: rule.Type, enum: namer.EnumName(e)}
+	if t.name == "" {
+		t.name = t.enum + "Error"
+	}
+	for _, m := range e.Members {
+		if m.identifier == rule.Success {
+			t.success = namer.EnumMemberName(m)
+		}
+	}
+	if t.success == "" {
+		return errorType{}, fmt.Errorf("error enum %s has no member %s", e.CName(), rule.Success)
+	}
+	return t, nil
+}
+
+// emitErrorType writes the error type t and the function making errors of
+// the error codes.
+func emitErrorType(t errorType, o io.Writer) {
+	fmt.Fprintf(o, "// %s is returned by functions failing with a %s.\n", t.name, t.enum)
+	fmt.Fprintf(o, "type %s struct {\n", t.name)
+	fmt.Fprintf(o, "\tCode     %s\n", t.enum)
+	fmt.Fprintf(o, "\tName     string\n")
+	fmt.Fprintf(o, "\tFunction string\n")
+	fmt.Fprintf(o, "}\n\n")
+	fmt.Fprintf(o, "func (e *%s) Error() string {\n", t.name)
+	fmt.Fprintf(o, "\treturn e.Function + \": \" + e.Name\n")
+	fmt.Fprintf(o, "}\n\n")
+
+	fmt.Fprintf(o, "// new%s returns nil if code is %s and a *%s otherwise.\n", t.name, t.success, t.name)
+	fmt.Fprintf(o, "func new%s(code %s, function string) error {\n", t.name, t.enum)
+	fmt.Fprintf(o, "\tif code == %s {\n", t.success)
+	fmt.Fprintf(o, "\t\treturn nil\n")
+	fmt.Fprintf(o, "\t}\n")
+	fmt.Fprintf(o, "\treturn &%s{code, code.String(), function}\n", t.name)
+	fmt.Fprintf(o, "}\n")
+}
+
+// bindError lets w return an error for the result of f if it is one of the
+// error enums of types.
+func bindError(w *wrapper, f Function, namer Namer, types map[string]errorType) {
+	r := w.retResult()
+	if r == nil {
+		return
+	}
+	t, ok := types[f.ResultType.typedefName(namer)]
+	if !ok {
+		return
+	}
+	r.goType = "error"
+	r.zero = "nil"
+	r.expr = fmt.Sprintf("new%s((%s)(ret), %q)", t.name, t.enum, w.name)
+}
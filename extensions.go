@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/token"
+	"os"
+	"strings"
+
+	"github.com/cznic/xc"
+)
+
+// How declarations of extensions are guarded, see PackageConfig.Extensions.
+const (
+	extensionsTags    = "tags"
+	extensionsRuntime = "runtime"
+)
+
+// guardRange is the lines enclosed by the guard of an extension.
+type guardRange struct {
+	name        string
+	first, last int
+}
+
+// extensionGuards finds the extensions declarations belong to. Extensions
+// are guarded like
+//
+//	#ifndef VG_KHR_EGL_image
+//	#define VG_KHR_EGL_image 1
+//	...
+//	#endif
+//
+// which tells them apart from include guards and default definitions.
+type extensionGuards struct {
+	files map[string][]guardRange
+}
+
+// lookup returns the innermost extension enclosing pos, "" if there is none.
+func (g *extensionGuards) lookup(pos token.Pos) string {
+	position := xc.FileSet.Position(pos)
+	if g.files == nil {
+		g.files = make(map[string][]guardRange)
+	}
+	guards, ok := g.files[position.Filename]
+	if !ok {
+		// Files which can not be read, such as the predefined source, have
+		// no extensions:
+		if src, err := os.ReadFile(position.Filename); err == nil {
+			guards = scanExtensionGuards(src)
+		}
+		g.files[position.Filename] = guards
+	}
+
+	name, size := "", 0
+	for _, r := range guards {
+		if r.first <= position.Line && position.Line <= r.last && (name == "" || r.last-r.first < size) {
+			name, size = r.name, r.last-r.first
+		}
+	}
+	return name
+}
+
+// scanExtensionGuards returns the extension guards of the C source src.
+func scanExtensionGuards(src []byte) []guardRange {
+	type conditional struct {
+		ifndef    string
+		extension bool
+		first     int
+	}
+	var (
+		guards []guardRange
+		stack  []conditional
+		// ifndef is set while the previous directive line is an #ifndef:
+		ifndef bool
+	)
+	s := bufio.NewScanner(bytes.NewReader(src))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+		wasIfndef := ifndef
+		ifndef = false
+		if !strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimSpace(text[1:]))
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "if", "ifdef":
+			stack = append(stack, conditional{first: line})
+		case "ifndef":
+			c := conditional{first: line}
+			if len(fields) > 1 {
+				c.ifndef = fields[1]
+				ifndef = true
+			}
+			stack = append(stack, c)
+		case "define":
+			top := len(stack) - 1
+			if wasIfndef && len(fields) > 2 && fields[1] == stack[top].ifndef && fields[2] == "1" {
+				stack[top].extension = true
+			}
+		case "endif":
+			if len(stack) == 0 {
+				continue
+			}
+			c := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if c.extension {
+				guards = append(guards, guardRange{c.ifndef, c.first, line})
+			}
+		}
+	}
+	return guards
+}
+
+// extensionsDecl returns HasExtension, which reports the extensions the
+// query C expression lists as available.
+func extensionsDecl(query string) Decl {
+	return Decl{
+		Name: "extensions",
+		Source: `var extensions struct {
+	sync.Mutex
+	names map[string]bool
+}
+
+// HasExtension reports whether the extension is available. It must not be
+// called before the implementation is initialized.
+func HasExtension(name string) bool {
+	extensions.Lock()
+	defer extensions.Unlock()
+	if extensions.names == nil {
+		list := C.cgogen_extensions()
+		if list == nil {
+			return false
+		}
+		extensions.names = make(map[string]bool)
+		for _, ext := range strings.Fields(C.GoString((*C.char)(list))) {
+			extensions.names[ext] = true
+		}
+	}
+	return extensions.names[name]
+}
+`,
+		Preamble: fmt.Sprintf("static const void *cgogen_extensions(void) { return (const void *)(%s); }\n", query),
+	}
+}
+
+// checkExtension makes w fail with a *NotAvailableError unless the
+// extension is available.
+func checkExtension(w *wrapper, extension string) {
+	w.addError()
+	check := fmt.Sprintf("if !HasExtension(%q) {\n\t%s\n}", extension, w.returnErr(fmt.Sprintf("&NotAvailableError{%q}", extension)))
+	w.setup = append([]string{check}, w.setup...)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanExtensionGuards(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		src  string
+		want []guardRange
+	}{
+		{"extension", `#ifndef __vgext_h_
+#define __vgext_h_
+
+#ifndef VG_KHR_EGL_image
+#define VG_KHR_EGL_image 1
+
+#ifdef VG_VGEXT_PROTOTYPES
+void vgCreateEGLImageTargetKHR(void);
+#endif
+
+#endif
+#endif
+`, []guardRange{{"VG_KHR_EGL_image", 4, 11}}},
+		{"nested", `#ifndef VG_KHR_advanced_blending
+#define VG_KHR_advanced_blending 1
+#ifndef VG_KHR_blend_subtract
+#define VG_KHR_blend_subtract 1
+#endif
+#endif
+`, []guardRange{{"VG_KHR_blend_subtract", 3, 5}, {"VG_KHR_advanced_blending", 1, 6}}},
+		{"default definition", `#ifndef VG_MAX_ENUM
+#define VG_MAX_ENUM 0x7FFFFFFF
+#endif
+`, nil},
+		{"define apart from ifndef", `#ifndef VG_API_CALL
+int x;
+#define VG_API_CALL 1
+#endif
+`, nil},
+		{"unbalanced endif", "#endif\n", nil},
+	} {
+		if got := scanExtensionGuards([]byte(test.src)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// flagResult names the result of a function in "function.parameter" globs,
+// such as those of flags and raw strings, which no C parameter can be named
+// like.
+const flagResult = "return"
+
+// isSingleFlag reports whether the enum value v is a single bit.
+func isSingleFlag(v interface{}) bool {
+	var n uint64
+	switch v := v.(type) {
+	case int32:
+		n = uint64(uint32(v))
+	case int64:
+		n = uint64(v)
+	case uint32:
+		n = uint64(v)
+	case uint64:
+		n = v
+	case int:
+		n = uint64(v)
+	default:
+		return false
+	}
+	return n != 0 && n&(n-1) == 0
+}
+
+// emitFlags writes the enum e as a set of flags, whose String function
+// uses the C names of the flags if cNames is set.
+func emitFlags(e Enum, o io.Writer, namer Namer, cNames bool) {
+	name := namer.EnumName(e)
+	fmt.Fprintf(o, "type %s uint32\n", name)
+	fmt.Fprintf(o, "const (\n")
+	for _, m := range e.Members {
+		fmt.Fprintf(o, "\t%s %s = %v\n", namer.EnumMemberName(m), name, m.Value)
+	}
+	fmt.Fprintf(o, ")\n\n")
+
+	fmt.Fprintf(o, "// Has reports whether every flag of f is set in s.\n")
+	fmt.Fprintf(o, "func (s %s) Has(f %s) bool { return s&f == f }\n\n", name, name)
+	fmt.Fprintf(o, "// Set sets the flags of f in s.\n")
+	fmt.Fprintf(o, "func (s *%s) Set(f %s) { *s |= f }\n\n", name, name)
+	fmt.Fprintf(o, "// Clear clears the flags of f in s.\n")
+	fmt.Fprintf(o, "func (s *%s) Clear(f %s) { *s &^= f }\n\n", name, name)
+
+	fmt.Fprintf(o, "// String lists the flags set in s separated by |.\n")
+	fmt.Fprintf(o, "func (s %s) String() string {\n", name)
+	fmt.Fprintf(o, "\tvar names []string\n")
+	fmt.Fprintf(o, "\tfor _, f := range []struct {\n")
+	fmt.Fprintf(o, "\t\tflag %s\n", name)
+	fmt.Fprintf(o, "\t\tname string\n")
+	fmt.Fprintf(o, "\t}{\n")
+	for _, m := range e.Members {
+		if isSingleFlag(m.Value) {
+			name := namer.EnumMemberName(m)
+			if cNames {
+				name = m.CName()
+			}
+			fmt.Fprintf(o, "\t\t{%s, %q},\n", namer.EnumMemberName(m), name)
+		}
+	}
+	fmt.Fprintf(o, "\t} {\n")
+	fmt.Fprintf(o, "\t\tif s&f.flag != 0 {\n")
+	fmt.Fprintf(o, "\t\t\tnames = append(names, f.name)\n")
+	fmt.Fprintf(o, "\t\t\ts &^= f.flag\n")
+	fmt.Fprintf(o, "\t\t}\n")
+	fmt.Fprintf(o, "\t}\n")
+	fmt.Fprintf(o, "\tif s != 0 || len(names) == 0 {\n")
+	fmt.Fprintf(o, "\t\tnames = append(names, fmt.Sprintf(\"%%#x\", uint32(s)))\n")
+	fmt.Fprintf(o, "\t}\n")
+	fmt.Fprintf(o, "\treturn strings.Join(names, \"|\")\n")
+	fmt.Fprintf(o, "}\n")
+}
+
+// bindFlags lets w take and return the flag types of the enums named in
+// flags for the parameters and results matching their globs.
+func bindFlags(w *wrapper, f Function, namer Namer, flags map[string][]string) {
+	enums := make([]string, 0, len(flags))
+	for enum := range flags {
+		enums = append(enums, enum)
+	}
+	sort.Strings(enums)
+
+	matches := func(name string) (string, bool) {
+		for _, enum := range enums {
+			for _, pattern := range flags[enum] {
+				if ok, _ := path.Match(pattern, f.CName()+"."+name); ok {
+					return namer.EnumName(Enum{identifier: enum}), true
+				}
+			}
+		}
+		return "", false
+	}
+	for i, p := range f.Parameters {
+		if goType, ok := matches(p.CName()); ok {
+			if wp := w.param(i); wp != nil {
+				wp.goType = goType
+			}
+		}
+	}
+	if r := w.retResult(); r != nil {
+		if goType, ok := matches(flagResult); ok {
+			r.goType = goType
+			r.expr = fmt.Sprintf("(%s)(ret)", goType)
+		}
+	}
+}
+
+// validFlagPatterns reports an error for flag globs which are not
+// "function.parameter" or "function.return".
+func validFlagPatterns(flags map[string][]string) error {
+	for enum, patterns := range flags {
+		if err := validParamPatterns(patterns); err != nil {
+			return fmt.Errorf("%v of %s", err, enum)
+		}
+	}
+	return nil
+}
+
+// validParamPatterns reports an error for globs which are not
+// "function.parameter" or "function.return".
+func validParamPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.Contains(pattern, ".") {
+			return fmt.Errorf("bad pattern %q: want function.parameter", pattern)
+		}
+	}
+	return nil
+}
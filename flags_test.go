@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnumNamesRoundTrip(t *testing.T) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	h, namer := parseSource(t, `typedef enum {
+  VG_RED          = 1 << 0,
+  VG_GREEN        = 1 << 1,
+  VG_BLUE         = 1 << 2,
+  VG_RGB          = VG_RED | VG_GREEN | VG_BLUE,
+  VG_COLOR_FORCE_SIZE = 0x7FFFFFFF
+} VGColorMask;
+
+typedef enum {
+  VG_EVEN_ODD     = 0x1900,
+  VG_NON_ZERO     = 0x1901,
+  VG_DEFAULT_RULE = VG_EVEN_ODD
+} VGFillRule;
+`)
+	for _, test := range []struct {
+		name   string
+		enum   string
+		flags  bool
+		cNames bool
+		// values are Go expressions of the values to round trip besides
+		// those of All, which only sets of flags may have unnamed.
+		values []string
+	}{
+		{"flags", "VGColorMask", true, false, []string{"0", "Red", "Red | Blue", "Rgb", "Green | 0x100"}},
+		{"c flags", "VGColorMask", true, true, []string{"0", "Red", "Red | Blue", "Rgb", "Green | 0x100"}},
+		{"enum", "VGFillRule", false, false, []string{"EvenOdd", "NonZero", "DefaultRule"}},
+		{"c enum", "VGFillRule", false, true, []string{"EvenOdd", "NonZero", "DefaultRule"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var e Enum
+			for _, en := range h.enums {
+				if en.CName() == test.enum {
+					e = en
+				}
+			}
+			name := namer.EnumName(e)
+
+			src := &bytes.Buffer{}
+			src.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"strconv\"\n\t\"strings\"\n)\n\n")
+			src.WriteString("var _ = strconv.ParseUint\nvar _ = strings.Split\n\n")
+			if test.flags {
+				emitFlags(e, src, namer, test.cNames)
+			} else {
+				emitEnum(e, src, namer)
+			}
+			emitEnumNames(e, src, namer, test.flags, test.cNames, []string{"*_FORCE_SIZE"})
+			src.WriteString("\nfunc main() {\n")
+			src.WriteString("\tvalues := append(All" + name + "(),\n")
+			for _, v := range test.values {
+				src.WriteString("\t\t" + v + ",\n")
+			}
+			src.WriteString("\t)\n")
+			src.WriteString("\tfor _, v := range values {\n")
+			src.WriteString("\t\tif p, err := Parse" + name + "(v.String()); err != nil || p != v {\n")
+			src.WriteString("\t\t\tfmt.Printf(\"Parse(%q) = %#x, %v, want %#x\\n\", v.String(), uint32(p), err, uint32(v))\n")
+			src.WriteString("\t\t\tos.Exit(1)\n")
+			src.WriteString("\t\t}\n")
+			src.WriteString("\t}\n")
+			src.WriteString("}\n")
+
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module roundtrip\n"), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "main.go"), src.Bytes(), 0666); err != nil {
+				t.Fatal(err)
+			}
+			cmd := exec.Command(goTool, "run", ".")
+			cmd.Dir = dir
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("%v\n%s\n%s", err, out, src)
+			}
+		})
+	}
+}
@@ -22,3 +22,12 @@ func blessName(name []byte) string {
 	}
 	return string(name)
 }
+
+// isReservedName reports whether name is reserved to the C implementation,
+// such as the __GO__ helper declared by basePredefines.
+func isReservedName(name string) bool {
+	if len(name) < 2 || name[0] != '_' {
+		return false
+	}
+	return name[1] == '_' || (name[1] >= 'A' && name[1] <= 'Z')
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cznic/cc"
+)
+
+// Loaders resolving entry points at run time, see PackageConfig.Loader.
+const (
+	loaderDlopen         = "dlopen"
+	loaderGetProcAddress = "getprocaddress"
+)
+
+// isProcType reports whether t is a function pointer type, such as those of
+// the PFN*PROC typedefs.
+func isProcType(t cc.Type) bool {
+	return t.Kind() == cc.Ptr && t.Element().Kind() == cc.Function
+}
+
+// procEntryName returns the upper case name of the entry point a PFN*PROC
+// typedef is declared for, e.g. VGCREATEEGLIMAGETARGETKHR for
+// PFNVGCREATEEGLIMAGETARGETKHRPROC.
+func procEntryName(typedefName string) (string, bool) {
+	if !strings.HasPrefix(typedefName, "PFN") || !strings.HasSuffix(typedefName, "PROC") {
+		return "", false
+	}
+	entry := typedefName[len("PFN") : len(typedefName)-len("PROC")]
+	return entry, entry != ""
+}
+
+// emitProcFunction writes the wrapper w of f calling the entry point
+// resolved at run time to o and its C trampoline, which calls through the
+// pfn function pointer typedef, to preamble.
+func emitProcFunction(w *wrapper, f Function, pfn string, o, preamble io.Writer, namer Namer) error {
+	resultCType := f.ResultType.CType(namer)
+	if resultCType == "" {
+		return fmt.Errorf("%s: can not spell the result type in C", f.CName())
+	}
+	cParams := []string{"void *cgogen_proc"}
+	cArgs := make([]string, 0, len(f.Parameters))
+	for i, p := range f.Parameters {
+		cType := p.Type.CType(namer)
+		if cType == "" {
+			return fmt.Errorf("%s: can not spell the type of parameter %s in C", f.CName(), p.CName())
+		}
+		cParams = append(cParams, fmt.Sprintf("%s p%d", cType, i))
+		cArgs = append(cArgs, fmt.Sprintf("p%d", i))
+	}
+
+	// C trampoline:
+	fmt.Fprintf(preamble, "static %s cgogen_%s(%s) {\n", resultCType, f.CName(), strings.Join(cParams, ", "))
+	fmt.Fprintf(preamble, "\t")
+	if f.ResultType.Kind() != cc.Void {
+		fmt.Fprintf(preamble, "return ")
+	}
+	fmt.Fprintf(preamble, "((%s)cgogen_proc)(%s);\n", pfn, strings.Join(cArgs, ", "))
+	fmt.Fprintf(preamble, "}\n")
+
+	// The wrapper calls the trampoline once the entry point is resolved:
+	w.cName = "cgogen_" + f.CName()
+	w.preArgs = append(w.preArgs, "addr")
+	w.addError()
+	w.setup = append([]string{fmt.Sprintf("addr, err := proc%s.addr()\nif err != nil {\n\t%s\n}", w.name, w.returnErr("err"))}, w.setup...)
+
+	fmt.Fprintf(o, "var proc%s = &proc{name: %q}\n\n", w.name, f.CName())
+	w.emit(o)
+	return nil
+}
+
+// notAvailableDecl returns the error of entry points and extensions the
+// driver does not provide.
+func notAvailableDecl() Decl {
+	return Decl{
+		Name: "NotAvailableError",
+		Source: `// NotAvailableError is returned by entry points and extensions the driver
+// does not provide.
+type NotAvailableError struct {
+	Name string
+}
+
+func (e *NotAvailableError) Error() string {
+	return e.Name + " is not available"
+}
+`,
+	}
+}
+
+// loaderDecl returns the run time support of the entry points resolved by
+// the package's loader.
+func loaderDecl(cfg *PackageConfig) Decl {
+	o := &bytes.Buffer{}
+	fmt.Fprint(o, `// proc is an entry point resolved on first use.
+type proc struct {
+	name string
+	once sync.Once
+	ptr  unsafe.Pointer
+}
+
+func (p *proc) addr() (unsafe.Pointer, error) {
+	p.once.Do(func() {
+		p.ptr = getProcAddress(p.name)
+	})
+	if p.ptr == nil {
+		return nil, &NotAvailableError{p.name}
+	}
+	return p.ptr, nil
+}
+`)
+
+	preamble := ""
+	switch cfg.Loader {
+	case loaderDlopen:
+		preamble = "#cgo linux LDFLAGS: -ldl\n#include <dlfcn.h>\n#include <stdlib.h>\n"
+		fmt.Fprintf(o, `
+// Library lists the shared libraries entry points are loaded from, the
+// first one that loads is used. It must be set before the first call.
+var Library = %#v
+
+var library struct {
+	once   sync.Once
+	handle unsafe.Pointer
+}
+
+func getProcAddress(name string) unsafe.Pointer {
+	library.once.Do(func() {
+		for _, lib := range Library {
+			cLib := C.CString(lib)
+			library.handle = C.dlopen(cLib, C.RTLD_NOW|C.RTLD_GLOBAL)
+			C.free(unsafe.Pointer(cLib))
+			if library.handle != nil {
+				break
+			}
+		}
+	})
+	if library.handle == nil {
+		return nil
+	}
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	return C.dlsym(library.handle, cName)
+}
+`, cfg.Library)
+	case loaderGetProcAddress:
+		fmt.Fprint(o, `
+// GetProcAddress resolves entry points by name, e.g. through
+// eglGetProcAddress. It must be set before the first call.
+var GetProcAddress func(name string) unsafe.Pointer
+
+func getProcAddress(name string) unsafe.Pointer {
+	if GetProcAddress == nil {
+		return nil
+	}
+	return GetProcAddress(name)
+}
+`)
+	}
+	return Decl{Name: "loader", Source: o.String(), Preamble: preamble}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcEntryName(t *testing.T) {
+	for name, want := range map[string]string{
+		"PFNVGCREATEEGLIMAGETARGETKHRPROC": "VGCREATEEGLIMAGETARGETKHR",
+		"PFNPROC":                          "",
+		"VGPROC":                           "",
+		"PFNVGFOO":                         "",
+	} {
+		got, ok := procEntryName(name)
+		if got != want || ok != (want != "") {
+			t.Errorf("procEntryName(%q) = %q, %v, want %q", name, got, ok, want)
+		}
+	}
+}
+
+func TestLoaders(t *testing.T) {
+	const src = `typedef int VGint;
+
+VGint vgScale(VGint a);
+typedef VGint (*PFNVGSCALEPROC)(VGint a);
+
+void vgFlush(void);
+`
+	for _, test := range []struct {
+		loader string
+		want   []string
+		absent []string
+	}{
+		{"", []string{"func Scale(\n\ta Int,\n) Int {", "C.vgScale("}, []string{"getProcAddress", "NotAvailableError"}},
+		{loaderDlopen, []string{
+			"func Scale(\n\ta Int,\n) (Int, error) {",
+			"addr, err := procScale.addr()",
+			"return ((PFNVGSCALEPROC)cgogen_proc)(p0);",
+			`var Library = []string{"libvendor.so"}`,
+			"C.dlsym(library.handle, cName)",
+			"type NotAvailableError struct",
+			// Functions without a PFN*PROC typedef are linked:
+			"C.vgFlush()",
+		}, []string{"GetProcAddress func"}},
+		{loaderGetProcAddress, []string{
+			"func Scale(\n\ta Int,\n) (Int, error) {",
+			"addr, err := procScale.addr()",
+			"var GetProcAddress func(name string) unsafe.Pointer",
+		}, []string{"dlopen"}},
+	} {
+		cfg := sourceConfig(t, src)
+		cfg.Loader = test.loader
+		cfg.Library = []string{"libvendor.so"}
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		files, err := generateCgo(cfg)
+		if err != nil {
+			t.Fatalf("loader %q: %v", test.loader, err)
+		}
+		var out strings.Builder
+		for _, f := range files {
+			out.Write(f.Data)
+		}
+		for _, w := range test.want {
+			if !strings.Contains(out.String(), w) {
+				t.Errorf("loader %q: no %q in\n%s", test.loader, w, out.String())
+			}
+		}
+		for _, a := range test.absent {
+			if strings.Contains(out.String(), a) {
+				t.Errorf("loader %q: %q in\n%s", test.loader, a, out.String())
+			}
+		}
+	}
+}
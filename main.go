@@ -1,212 +1,779 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/cznic/cc"
 )
 
-func generateCgo(srcPaths []string, packageName string, outPath string, namer Namer) error {
-	// Use 64-bit C types model:
+//go:generate go run . -manifest openvg.json
+
+func generateCgo(cfg *PackageConfig) ([]OutputFile, error) {
+	perArch := make([][]Decl, len(cfg.Arches))
+	for i, goarch := range cfg.Arches {
+		decls, err := generateDecls(cfg, goarch, NewRuleNamer(cfg))
+		if err != nil {
+			if len(cfg.Arches) > 1 {
+				return nil, fmt.Errorf("%s: %v", goarch, err)
+			}
+			return nil, err
+		}
+		perArch[i] = decls
+	}
+
+	common, specific := splitArchDecls(perArch)
+	var files []OutputFile
+	render := func(path, buildConstraint string, decls []Decl) error {
+		src, err := renderGoFile(cfg, buildConstraint, decls)
+		if err != nil && path != cfg.Output {
+			return fmt.Errorf("%s: %v", path, err)
+		} else if err != nil {
+			return err
+		}
+		files = append(files, OutputFile{path, src})
+		return nil
+	}
+	for i, arch := range append([]string{""}, cfg.Arches...) {
+		decls := common
+		if arch != "" {
+			if len(cfg.Arches) == 1 {
+				break
+			}
+			decls = specific[i-1]
+		}
+		goarch := goarchOf(arch)
+		for _, group := range splitExtensionDecls(decls) {
+			var constraints []string
+			if goarch != "" {
+				constraints = append(constraints, goarch)
+			}
+			if group.extension != "" && cfg.Extensions == extensionsTags {
+				constraints = append(constraints, group.extension)
+			}
+			buildConstraint := strings.Join(constraints, " && ")
+
+			local, exported := splitExportDecls(group.decls)
+			for _, build := range splitBuildDecls(local) {
+				// The files of a build or an architecture are only written
+				// if they declare something:
+				if len(build.decls) == 0 && (build.build != "" || goarch != "") {
+					continue
+				}
+				buildConstraint := buildConstraint
+				if c := debugConstraint(build.build, cfg.Debug); c != "" {
+					buildConstraint = strings.Join(append(constraints, c), " && ")
+				}
+				path := outputPath(cfg.Output, group.extension, build.build, false, goarch)
+				if err := render(path, buildConstraint, build.decls); err != nil {
+					return nil, err
+				}
+			}
+			if len(exported) > 0 {
+				path := outputPath(cfg.Output, group.extension, "", true, goarch)
+				if err := render(path, buildConstraint, exported); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// declGroup is the declarations of an extension, or those of none.
+type declGroup struct {
+	extension string
+	decls     []Decl
+}
+
+// splitExtensionDecls groups decls by extension, the declarations of no
+// extension come first even if there are none.
+func splitExtensionDecls(decls []Decl) []declGroup {
+	groups := []declGroup{{}}
+	index := map[string]int{"": 0}
+	for _, d := range decls {
+		i, ok := index[d.Extension]
+		if !ok {
+			i = len(groups)
+			index[d.Extension] = i
+			groups = append(groups, declGroup{extension: d.Extension})
+		}
+		groups[i].decls = append(groups[i].decls, d)
+	}
+	return groups
+}
+
+// buildGroup is the declarations of a build, see Decl.Build.
+type buildGroup struct {
+	build string
+	decls []Decl
+}
+
+// splitBuildDecls groups decls by build, those of every build come first
+// even if there are none, followed by those of the builds without and with
+// the debug tag.
+func splitBuildDecls(decls []Decl) []buildGroup {
+	groups := []buildGroup{{}, {build: buildNoDebug}, {build: buildDebug}}
+	for _, d := range decls {
+		for i := range groups {
+			if groups[i].build == d.Build {
+				groups[i].decls = append(groups[i].decls, d)
+			}
+		}
+	}
+	return groups
+}
+
+// splitExportDecls separates the declarations exporting Go functions to C.
+func splitExportDecls(decls []Decl) (local, exported []Decl) {
+	for _, d := range decls {
+		if d.Export {
+			exported = append(exported, d)
+		} else {
+			local = append(local, d)
+		}
+	}
+	return local, exported
+}
+
+// Decl is the generated Go source of a single C declaration together with
+// the C source it needs in the cgo preamble. Exported functions, the
+// declarations of extensions and those of a single build, which Build
+// names, go to files of their own, see outputPath.
+type Decl struct {
+	Name      string
+	Source    string
+	Preamble  string
+	Export    bool
+	Extension string
+	Build     string
+}
+
+// headerDecls holds the declarations of the headers of a package.
+type headerDecls struct {
+	functions []Function
+	typedefs  []Typedef
+	structs   []Struct
+	unions    []Union
+	enums     []Enum
+	consts    []Const
+	// procs maps upper case entry point names to their PFN*PROC typedefs:
+	procs map[string]string
+	// extensionOf maps identifiers to the extension declaring them:
+	extensionOf map[string]string
+}
+
+// parseHeaders parses the headers of cfg for goarch and returns the
+// declarations namer does not ignore, registering the typedefs with it.
+func parseHeaders(cfg *PackageConfig, goarch string, namer Namer) (*headerDecls, error) {
+	// Use the C types model of the target architecture:
+	arch := arches[goarch]
 	model := &cc.Model{
 		Items: make(map[cc.Kind]cc.ModelItem),
 	}
-	for k, v := range models[Arch64].Items {
+	for k, v := range models[arch].Items {
 		model.Items[k] = v
 	}
+	predefines := []string{
+		builtinBase,
+		basePredefines,
+		archPredefines[arch],
+		builtinBaseUndef,
+	}
+	predefines = append(predefines, cfg.Predefines...)
+	predefines = append(predefines, definesSource(cfg.Defines))
+	predefined := strings.Join(predefines, "\n")
 
-	// Parse openvg.h main header:
-	tu, err := cc.Parse("", srcPaths, model,
-		cc.SysIncludePaths([]string{"."}),
-		cc.AllowCompatibleTypedefRedefinitions(),
-	)
-	if err != nil {
-		return err
+	var includePaths []string
+	if len(cfg.IncludePaths) == 0 {
+		includePaths = append(includePaths, ".")
 	}
+	includePaths = append(includePaths, cfg.IncludePaths...)
+	includePaths = append(includePaths, cfg.SysIncludePaths...)
 
-	o, err := os.OpenFile(outPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	// Parse the headers:
+	tu, err := cc.Parse(predefined, cfg.Headers, model,
+		cc.SysIncludePaths(includePaths),
+		cc.AllowCompatibleTypedefRedefinitions(),
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer o.Close()
 
 	functions := make([]Function, 0, 50)
+	typedefs := make([]Typedef, 0, 50)
+	structs := make([]Struct, 0, 10)
+	unions := make([]Union, 0, 10)
 	enums := make([]Enum, 0, 50)
+	procs := make(map[string]string)
 
-	u := tu
-	for u != nil {
-		e := u.ExternalDeclaration
-		if e.Case != 1 {
-			continue
-		}
-
-		// Declaration
-		decl := e.Declaration
-		if decl == nil {
-			u = u.TranslationUnit
-			continue
-		}
+	// declared guards against declarations repeated by the headers, e.g.
+	// prototypes of functions defined later or compatible typedefs:
+	declared := make(map[string]bool)
+	// enumTypedefs maps the first member of every enum to its typedef, so
+	// that further typedefs of the same enum become aliases:
+	enumTypedefs := make(map[string]string)
+	guards := &extensionGuards{}
+	extensionOf := make(map[string]string)
+	// typedefNames holds every typedef, for the casts of constants:
+	typedefNames := make(map[string]bool)
+	// specifierTypedefs maps the specifiers of enum, struct and union
+	// typedefs to the typedef of their first declarator, which the pointers
+	// declared along with it, as PTE of typedef enum {...} TE, *PTE, point to:
+	specifierTypedefs := make(map[cc.Specifier]string)
+	// importNamers name the typedefs of the packages whose types are imported:
+	importNamers := make([]*RuleNamer, len(cfg.ImportTypes))
+	for i, imp := range cfg.ImportTypes {
+		importNamers[i] = NewRuleNamer(imp.cfg)
+	}
 
-		d := decl.InitDeclaratorListOpt.InitDeclaratorList.InitDeclarator.Declarator
+	visit := func(d *cc.Declarator) {
 		dd := d.DirectDeclarator
-		if dd.ParameterTypeList != nil {
+		ignoreFile := namer.IgnoreFile(fileOf(positionOf(dd)))
+		if cfg.Extensions != "" {
+			if ext := guards.lookup(positionOf(dd)); ext != "" {
+				extensionOf[identifierOf(dd)] = ext
+			}
+		}
+		if !d.RawSpecifier().IsTypedef() {
+			if d.Type.Kind() != cc.Function || dd.ParameterTypeList == nil {
+				return // Variables and K&R style functions are not supported.
+			}
 			f := parseFunction(d)
-			if !namer.IgnoreFunction(f.identifier) {
+			if !declared["func "+f.identifier] && !ignoreFile && !isReservedName(f.identifier) && !namer.IgnoreFunction(f.identifier) {
+				declared["func "+f.identifier] = true
 				functions = append(functions, f)
 			}
-		} else {
-			if d.Type.Kind() == cc.Enum {
-				en := parseEnum(d)
-				if !namer.IgnoreEnum(en.identifier) {
-					enums = append(enums, en)
-					namer.RegisterTypedefEnum(en.identifier)
+			return
+		}
+
+		// Even ignored typedefs are needed to spell types in C:
+		identifier := identifierOf(dd)
+		namer.RegisterIndirections(identifier, indirections(d.Type))
+		typedefNames[identifier] = true
+		if ignoreFile && !declared["type "+identifier] {
+			for i, imp := range cfg.ImportTypes {
+				if goName := importedTypeName(d, importNamers[i]); goName != "" {
+					namer.RegisterImportedTypedef(identifier, imp.Package+"."+goName)
+					break
 				}
 			}
 		}
+		if declared["type "+identifier] || ignoreFile || isReservedName(identifier) {
+			return
+		}
+		declared["type "+identifier] = true
 
-		u = u.TranslationUnit
+		switch {
+		case d.Type.Kind() == cc.Enum:
+			en := parseEnum(d)
+			if namer.IgnoreEnum(en.identifier) {
+				return
+			}
+			if len(en.Members) > 0 {
+				if first, ok := enumTypedefs[en.Members[0].identifier]; ok {
+					td := parseTypedef(d)
+					td.underlying = namer.TypedefGoName(first)
+					td.alias = true
+					typedefs = append(typedefs, td)
+					namer.RegisterTypedef(td.identifier)
+					return
+				}
+				enumTypedefs[en.Members[0].identifier] = en.identifier
+			}
+			enums = append(enums, en)
+			namer.RegisterTypedefEnum(en.identifier)
+			specifierTypedefs[d.RawSpecifier()] = en.identifier
+		case d.Type.Kind() == cc.Struct:
+			st := parseStruct(d)
+			if !namer.IgnoreTypedef(st.identifier) {
+				structs = append(structs, st)
+				namer.RegisterTypedef(st.identifier)
+				if tag := tagOf(d.Type); tag != "" {
+					namer.RegisterStructTag(tag, st.identifier)
+				}
+				specifierTypedefs[d.RawSpecifier()] = st.identifier
+			}
+		case d.Type.Kind() == cc.Union:
+			un := parseUnion(d)
+			if !namer.IgnoreTypedef(un.identifier) {
+				unions = append(unions, un)
+				namer.RegisterTypedef(un.identifier)
+				specifierTypedefs[d.RawSpecifier()] = un.identifier
+			}
+		case isProcType(d.Type):
+			if entry, ok := procEntryName(identifier); ok {
+				procs[entry] = identifier
+			}
+		case isNamedTypeKind(d.Type):
+			td := parseTypedef(d)
+			if !namer.IgnoreTypedef(td.identifier) {
+				td.underlying = td.Type.GoType(namer)
+				if first, ok := specifierTypedefs[d.RawSpecifier()]; ok {
+					if stars, ok := pointerPrefix(d.Type); ok {
+						td.underlying = stars + namer.TypedefGoName(first)
+					}
+				}
+				typedefs = append(typedefs, td)
+				namer.RegisterTypedef(td.identifier)
+			}
+		}
 	}
 
-	fmt.Fprintf(o, `package %s
-
-//#cgo LDFLAGS: -lAmanithVG
-`, packageName)
-	for _, s := range srcPaths {
-		fmt.Fprintf(o, "//#include \"%s\"\n", s)
+	for u := tu; u != nil; u = u.TranslationUnit {
+		e := u.ExternalDeclaration
+		switch e.Case {
+		case 0: // FunctionDefinition
+			visit(e.FunctionDefinition.Declarator)
+		case 1: // Declaration
+			// Declarations like "struct foo {...};" declare no identifier:
+			if e.Declaration.InitDeclaratorListOpt == nil {
+				continue
+			}
+			for l := e.Declaration.InitDeclaratorListOpt.InitDeclaratorList; l != nil; l = l.InitDeclaratorList {
+				visit(l.InitDeclarator.Declarator)
+			}
+		}
 	}
-	fmt.Fprintln(o, `import "C"
-
-import "unsafe"`)
 
-	for _, e := range enums {
-		fmt.Fprintln(o)
-		emitEnum(e, o, namer)
+	// Object-like macros defined by the user are configuration, not API:
+	userDefines := make(map[string]bool, len(cfg.Defines))
+	for _, d := range cfg.Defines {
+		userDefines[strings.SplitN(d, "=", 2)[0]] = true
 	}
-
-	for _, f := range functions {
-		fmt.Fprintln(o)
-		emitFunction(f, o, namer)
+	consts := make([]Const, 0, len(tu.Macros))
+	for _, m := range sortedMacros(tu.Macros) {
+		c, ok := parseConst(m, tu.Macros, typedefNames)
+		if !ok || isReservedName(c.identifier) || userDefines[c.identifier] || namer.IgnoreFile(fileOf(m.DefTok.Pos())) || namer.IgnoreConst(c.identifier) {
+			continue
+		}
+		consts = append(consts, c)
+		if cfg.Extensions != "" {
+			if ext := guards.lookup(m.DefTok.Pos()); ext != "" {
+				extensionOf[c.identifier] = ext
+			}
+		}
 	}
 
-	return nil
+	return &headerDecls{
+		functions:   functions,
+		typedefs:    typedefs,
+		structs:     structs,
+		unions:      unions,
+		enums:       enums,
+		consts:      consts,
+		procs:       procs,
+		extensionOf: extensionOf,
+	}, nil
 }
 
-func goName(name string) string {
-	if strings.HasPrefix(name, "VG") {
-		return Export(name[2:])
+// generateDecls parses the package headers for one target architecture and
+// generates the Go source of every declaration in them.
+func generateDecls(cfg *PackageConfig, goarch string, namer Namer) ([]Decl, error) {
+	h, err := parseHeaders(cfg, goarch, namer)
+	if err != nil {
+		return nil, err
 	}
-	return Export(name)
-}
 
-type VGNamer struct {
-	typedefs map[string]string
-}
+	decls := make([]Decl, 0, len(h.consts)+len(h.typedefs)+len(h.structs)+len(h.unions)+len(h.enums)+len(h.functions))
+	buf := &bytes.Buffer{}
+	for _, c := range h.consts {
+		buf.Reset()
+		emitConst(c, buf, namer)
+		decls = append(decls, Decl{Name: "const " + c.CName(), Source: buf.String()})
+	}
+	for _, t := range h.typedefs {
+		buf.Reset()
+		emitTypedef(t, buf, namer)
+		decls = append(decls, Decl{Name: "type " + t.CName(), Source: buf.String()})
+	}
+	for _, st := range h.structs {
+		buf.Reset()
+		emitStruct(st, buf, namer)
+		decls = append(decls, Decl{Name: "struct " + st.CName(), Source: buf.String()})
+	}
+	for _, un := range h.unions {
+		buf.Reset()
+		emitUnion(un, buf, namer)
+		decls = append(decls, Decl{Name: "union " + un.CName(), Source: buf.String()})
+	}
 
-func (n *VGNamer) RegisterTypedefEnum(identifier string) {
-	//fmt.Printf("enum: %s\n", identifier)
-	n.typedefs[identifier] = n.EnumName(Enum{identifier: identifier})
-}
-func (n *VGNamer) TypedefGoName(identifier string) string {
-	name, _ := n.typedefs[identifier]
-	//fmt.Printf("is enum? %s = %v: %s\n", identifier, ok, name)
-	return name
-}
+	errorTypes := make(map[string]errorType)
+	for _, e := range h.enums {
+		buf.Reset()
+		_, flags := cfg.Flags[e.identifier]
+		if flags {
+			emitFlags(e, buf, namer, cfg.EnumNames == enumNamesC)
+		} else {
+			emitEnum(e, buf, namer)
+		}
+		emitEnumNames(e, buf, namer, flags, cfg.EnumNames == enumNamesC, cfg.EnumSentinels)
+		if rule, ok := cfg.ErrorEnums[e.identifier]; ok {
+			t, err := newErrorType(e, rule, namer)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintln(buf)
+			emitErrorType(t, buf)
+			errorTypes[e.identifier] = t
+		}
+		decls = append(decls, Decl{Name: "enum " + e.CName(), Source: buf.String()})
+	}
 
-func (n *VGNamer) IgnoreEnum(name string) bool {
-	return false
-}
-func (n *VGNamer) IgnoreFunction(name string) bool {
-	return false
-}
-func (n *VGNamer) EnumName(e Enum) string {
-	name := e.identifier
-	if strings.HasPrefix(name, "VG") {
-		name = name[2:]
+	var debugCheck *Function
+	if cfg.Debug != "" {
+		for i := range h.functions {
+			if h.functions[i].CName() == cfg.DebugCheck {
+				debugCheck = &h.functions[i]
+			}
+		}
+		if debugCheck == nil || len(debugCheck.Parameters) > 0 || debugCheck.ResultType.Kind() == cc.Void {
+			return nil, fmt.Errorf("no debug check function %s() returning an error code", cfg.DebugCheck)
+		}
 	}
-	return Export(name) + "Enum"
-}
-func (n *VGNamer) EnumMemberName(m EnumMember) string {
-	name := m.identifier
-	if strings.HasPrefix(name, "VG_") {
-		name = name[3:]
+
+	dynamic, checked := false, false
+	callbacks := &callbackSet{}
+	emitWrapper := func(f Function, debug bool) (Decl, error) {
+		buf.Reset()
+		d := Decl{Name: "func " + f.CName()}
+		w := newWrapper(f, namer)
+		slices := slicePairs(f, namer, cfg.Slices, cfg.SliceHeuristics)
+		bindSlices(w, f, namer, slices)
+		bindOuts(w, f, namer, outParams(f, namer, cfg.OutParams, cfg.OutHeuristics, slices))
+		if bindStrings(w, f, namer, cfg.RawStrings) {
+			d.Preamble = stringsPreamble
+		}
+		bindFlags(w, f, namer, cfg.Flags)
+		bindError(w, f, namer, errorTypes)
+		if cb, ok := bindCallbacks(w, f, namer, callbacks, matchAny(cfg.RetainCallbacks, f.identifier)); ok {
+			d.Preamble += callbacksPreamble + callbackPrototype(cb, namer)
+		}
+		if ext := h.extensionOf[f.identifier]; ext != "" && cfg.Extensions == extensionsRuntime {
+			checkExtension(w, ext)
+			checked = true
+		}
+		if debug {
+			// The debug build has a variant of its own:
+			d.Name = "debug " + f.CName()
+			d.Build = buildDebug
+			checkDebug(w, *debugCheck, namer)
+		}
+		if pfn, ok := h.procs[strings.ToUpper(f.identifier)]; ok && cfg.Loader != "" {
+			preamble := &bytes.Buffer{}
+			if err := emitProcFunction(w, f, pfn, buf, preamble, namer); err != nil {
+				return Decl{}, err
+			}
+			d.Preamble += preamble.String()
+			dynamic = true
+		} else {
+			emitFunction(w, buf)
+		}
+		d.Source = buf.String()
+		return d, nil
 	}
-	parts := strings.Split(name, "_")
-	goName := ""
-	for _, p := range parts {
-		goName += strings.Title(strings.ToLower(p))
+	for _, f := range h.functions {
+		// A function the package can not wrap must not fail the others:
+		if err := f.checkTypes(namer); err != nil {
+			fmt.Fprintf(os.Stderr, "cgogen: skipping %s: %v\n", f.CName(), err)
+			continue
+		}
+		d, err := emitWrapper(f, false)
+		if err != nil {
+			return nil, err
+		}
+		if debugCheck == nil || f.CName() == debugCheck.CName() {
+			decls = append(decls, d)
+			continue
+		}
+		d.Build = buildNoDebug
+		debug, err := emitWrapper(f, true)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, d, debug)
 	}
-	return goName
-}
-func (n *VGNamer) FunctionName(f Function) string {
-	goName := f.identifier
-	if strings.HasPrefix(goName, "vg") {
-		goName = goName[2:]
+	if dynamic || checked {
+		decls = append(decls, notAvailableDecl())
+	}
+	if dynamic {
+		decls = append(decls, loaderDecl(cfg))
+	}
+	if checked {
+		decls = append(decls, extensionsDecl(cfg.ExtensionQuery))
+	}
+	for _, cb := range callbacks.list {
+		buf.Reset()
+		emitCallback(cb, buf, namer)
+		decls = append(decls, Decl{Name: "callback " + cb.CName(), Source: buf.String()})
+		buf.Reset()
+		emitCallbackExport(cb, buf, namer)
+		decls = append(decls, Decl{Name: "export " + cb.CName(), Source: buf.String(), Export: true})
+	}
+	if debugCheck != nil {
+		decls = append(decls, debugDecl(cfg.DebugAction))
 	}
-	return strings.Title(goName)
-}
-func (n *VGNamer) ParameterName(p Parameter) string {
-	return p.identifier
-}
 
-type VGUNamer struct {
-	typedefs map[string]string
-}
+	// Decl names are the kind followed by the C identifier:
+	for i, d := range decls {
+		decls[i].Extension = h.extensionOf[d.Name[strings.IndexByte(d.Name, ' ')+1:]]
+	}
 
-func (n *VGUNamer) RegisterTypedefEnum(identifier string) {
-	n.typedefs[identifier] = n.EnumName(Enum{identifier: identifier})
+	return decls, nil
 }
-func (n *VGUNamer) TypedefGoName(identifier string) string {
-	name, _ := n.typedefs[identifier]
-	//fmt.Printf("is enum? %s = %v: %s\n", identifier, ok, name)
-	return name
+
+// importedTypeName returns the Go name of the typedef d in the package of
+// namer, "" if that package does not declare it.
+func importedTypeName(d *cc.Declarator, namer Namer) string {
+	identifier := identifierOf(d.DirectDeclarator)
+	if namer.IgnoreFile(fileOf(positionOf(d.DirectDeclarator))) || isReservedName(identifier) {
+		return ""
+	}
+	switch {
+	case d.Type.Kind() == cc.Enum:
+		if !namer.IgnoreEnum(identifier) {
+			return namer.EnumName(Enum{identifier: identifier})
+		}
+	case d.Type.Kind() == cc.Struct, d.Type.Kind() == cc.Union:
+		if !namer.IgnoreTypedef(identifier) {
+			return namer.TypedefName(Typedef{identifier: identifier})
+		}
+	case isProcType(d.Type):
+	case isNamedTypeKind(d.Type):
+		if !namer.IgnoreTypedef(identifier) {
+			return namer.TypedefName(Typedef{identifier: identifier})
+		}
+	}
+	return ""
 }
 
-func (n *VGUNamer) IgnoreEnum(name string) bool {
-	return !strings.HasPrefix(name, "VGU")
+// pointerPrefix returns a * for every pointer level of t if it points to an
+// enum, struct or union.
+func pointerPrefix(t cc.Type) (string, bool) {
+	stars := ""
+	for ; t.Kind() == cc.Ptr; t = t.Element() {
+		stars += "*"
+	}
+	switch t.Kind() {
+	case cc.Enum, cc.Struct, cc.Union:
+		return stars, stars != ""
+	}
+	return "", false
 }
-func (n *VGUNamer) IgnoreFunction(name string) bool {
-	return !strings.HasPrefix(name, "vgu")
+
+// isNamedTypeKind reports whether a typedef of t becomes a Go named type.
+// Enums, structs and unions are generated on their own and functions are not
+// supported yet.
+func isNamedTypeKind(t cc.Type) bool {
+	switch t.Kind() {
+	case cc.Enum, cc.Struct, cc.Union, cc.Function, cc.Undefined:
+		return false
+	case cc.Ptr:
+		return t.Element().Kind() != cc.Function
+	}
+	return true
 }
-func (n *VGUNamer) EnumName(e Enum) string {
-	name := e.identifier
-	if strings.HasPrefix(name, "VGU") {
-		name = name[3:]
+
+// sortedMacros returns the macros in the order they were defined.
+func sortedMacros(macros map[int]*cc.Macro) []*cc.Macro {
+	sorted := make([]*cc.Macro, 0, len(macros))
+	for _, m := range macros {
+		sorted = append(sorted, m)
 	}
-	return Export(name) + "Enum"
+	sort.Slice(sorted, func(i, j int) bool {
+		pi, pj := sorted[i].DefTok.Pos(), sorted[j].DefTok.Pos()
+		if pi != pj {
+			return pi < pj
+		}
+		return string(sorted[i].DefTok.S()) < string(sorted[j].DefTok.S())
+	})
+	return sorted
 }
-func (n *VGUNamer) EnumMemberName(m EnumMember) string {
-	name := m.identifier
-	if strings.HasPrefix(name, "VGU_") {
-		name = name[4:]
+
+// splitArchDecls separates the declarations generated identically for every
+// architecture from those that differ or exist only on some of them.
+func splitArchDecls(perArch [][]Decl) (common []Decl, specific [][]Decl) {
+	sources := make([]map[string]Decl, len(perArch))
+	for i, decls := range perArch {
+		sources[i] = make(map[string]Decl, len(decls))
+		for _, d := range decls {
+			sources[i][d.Name] = d
+		}
 	}
-	parts := strings.Split(name, "_")
-	goName := ""
-	for _, p := range parts {
-		goName += strings.Title(strings.ToLower(p))
+	isCommon := func(d Decl) bool {
+		for _, src := range sources {
+			if s, ok := src[d.Name]; !ok || s != d {
+				return false
+			}
+		}
+		return true
 	}
-	return goName
-}
-func (n *VGUNamer) FunctionName(f Function) string {
-	goName := f.identifier
-	if strings.HasPrefix(goName, "vgu") {
-		goName = goName[3:]
+
+	specific = make([][]Decl, len(perArch))
+	for i, decls := range perArch {
+		for _, d := range decls {
+			if !isCommon(d) {
+				specific[i] = append(specific[i], d)
+			} else if i == 0 {
+				common = append(common, d)
+			}
+		}
 	}
-	return strings.Title(goName)
+	return common, specific
 }
-func (n *VGUNamer) ParameterName(p Parameter) string {
-	return p.identifier
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: cgogen [flags] header.h...\n       cgogen -manifest file.json\n\nFlags:\n")
+	flag.PrintDefaults()
 }
 
 func main() {
-	var err error
-	err = generateCgo([]string{"VG/openvg.h"}, "vg", "../golang-openvg/vg/vg.go", &VGNamer{typedefs: make(map[string]string)})
-	if err != nil {
-		panic(err)
+	cfg := &PackageConfig{}
+	var manifestPath, prefix string
+	var check bool
+	var targetArches commaList
+	var includePaths, sysIncludePaths, predefineFiles, defines, include, exclude, includeFiles, excludeFiles stringList
+	var cflags, ldflags, pkgConfig, cgoDirectives, cincludes, library, retainCallbacks, enumSentinels, rawStrings stringList
+
+	flag.BoolVar(&check, "check", false, "do not write any files, print a diff and fail if they are out of date")
+	flag.StringVar(&manifestPath, "manifest", "", "generate every package listed in the JSON manifest `file`")
+	flag.StringVar(&cfg.Package, "pkg", os.Getenv("GOPACKAGE"), "Go package `name` of the generated bindings (defaults to $GOPACKAGE)")
+	flag.StringVar(&cfg.Output, "o", "", "output Go `file`")
+	flag.Var(&targetArches, "arch", "target `GOARCH` selecting the C types model; repeat or separate by commas to split output into per-architecture files")
+	flag.StringVar(&prefix, "prefix", "", "C symbol `prefix` stripped from Go names, e.g. VG")
+	flag.Var(&include, "include", "only generate symbols matching `glob` (repeatable)")
+	flag.Var(&exclude, "exclude", "skip symbols matching `glob` (repeatable)")
+	flag.Var(&includeFiles, "include-file", "only generate symbols declared in files matching `glob`, e.g. VG/vgu.h (repeatable)")
+	flag.Var(&excludeFiles, "exclude-file", "skip symbols declared in files matching `glob` (repeatable)")
+	flag.Var(&includePaths, "I", "add `dir` to the include search path (repeatable)")
+	flag.Var(&sysIncludePaths, "isystem", "add `dir` to the system include search path, e.g. for <stdint.h> (repeatable)")
+	flag.Var(&predefineFiles, "predefine", "prepend the C source in `file` to the parsed headers (repeatable)")
+	flag.Var(&defines, "D", "predefine `name[=value]` for the preprocessor (repeatable)")
+	flag.Var(&cflags, "cflags", "C compiler `flag` for the generated cgo preamble (repeatable)")
+	flag.Var(&ldflags, "ldflags", "linker `flag` for the generated cgo preamble (repeatable)")
+	flag.Var(&pkgConfig, "pkg-config", "pkg-config `package` for the generated cgo preamble (repeatable)")
+	flag.Var(&cgoDirectives, "cgo", "platform specific cgo `directive`, e.g. \"linux,arm LDFLAGS: -lShivaVG\" (repeatable)")
+	flag.Var(&cincludes, "cinclude", "`header` to #include in the generated preamble instead of the parsed ones (repeatable)")
+	flag.StringVar(&cfg.Loader, "loader", "", "resolve functions with a PFN*PROC typedef at run time through `loader` dlopen or getprocaddress")
+	flag.Var(&library, "library", "shared `library` the dlopen loader tries (repeatable)")
+	flag.StringVar(&cfg.Extensions, "extensions", "", "split off extensions into files guarded by `mode` tags (build tags) or runtime (checking -extension-query)")
+	flag.StringVar(&cfg.ExtensionQuery, "extension-query", "", "C `expression` listing the available extensions, e.g. \"vgGetString(VG_EXTENSIONS)\"")
+	flag.Var(&retainCallbacks, "retain-callbacks", "keep the callbacks passed to functions matching `glob` registered after the call and return their handles (repeatable)")
+	flag.StringVar(&cfg.EnumNames, "enum-names", "", "`names` of enum members in String and Parse functions, go or c")
+	flag.Var(&enumSentinels, "enum-sentinel", "skip enum members matching `glob` in String, Parse and All functions, e.g. *_FORCE_SIZE (repeatable)")
+	flag.BoolVar(&cfg.SliceHeuristics, "slice-heuristics", false, "pass pointer parameters next to a count parameter, e.g. count or numSegments, as Go slices")
+	flag.BoolVar(&cfg.OutHeuristics, "out-heuristics", false, "return non-const pointer parameters to scalars, e.g. the bounds of vgPathBounds, as results")
+	flag.Var(&rawStrings, "raw-string", "keep const char pointers matching `glob` function.parameter or function.return, which are not NUL-terminated, pointers (repeatable)")
+	flag.StringVar(&cfg.Debug, "debug", "", "build `tag`, e.g. vgdebug, selecting wrappers which check -debug-check after every call")
+	flag.StringVar(&cfg.DebugCheck, "debug-check", "", "C `function` returning the pending error code checked by the debug build, e.g. vgGetError")
+	flag.StringVar(&cfg.DebugAction, "debug-action", "", "`action` of the debug build on pending errors, panic or log")
+	flag.Usage = usage
+	flag.Parse()
+
+	var packages []*PackageConfig
+	if manifestPath != "" {
+		if flag.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "cgogen: headers cannot be given together with -manifest\n")
+			usage()
+			os.Exit(2)
+		}
+		m, err := LoadManifest(manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cgogen: %v\n", err)
+			os.Exit(1)
+		}
+		packages = m.Packages
+
+		// An explicit -arch overrides the manifest:
+		if len(targetArches) > 0 {
+			for _, p := range packages {
+				p.Arches = targetArches
+			}
+		}
+	} else {
+		cfg.Headers = flag.Args()
+		cfg.Arches = targetArches
+		if len(cfg.Arches) == 0 {
+			cfg.Arches = []string{defaultArch}
+		}
+		cfg.Naming = NamingFor(prefix)
+		cfg.Include = include
+		cfg.Exclude = exclude
+		cfg.IncludeFiles = includeFiles
+		cfg.ExcludeFiles = excludeFiles
+		cfg.IncludePaths = includePaths
+		cfg.SysIncludePaths = sysIncludePaths
+		for _, path := range predefineFiles {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "cgogen: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.Predefines = append(cfg.Predefines, string(src))
+		}
+		cfg.Defines = defines
+		cfg.CFlags = cflags
+		cfg.LDFlags = ldflags
+		cfg.PkgConfig = pkgConfig
+		cfg.Includes = cincludes
+		cfg.Library = library
+		cfg.RetainCallbacks = retainCallbacks
+		cfg.EnumSentinels = enumSentinels
+		cfg.RawStrings = rawStrings
+		for _, d := range cgoDirectives {
+			f, err := parseCgoDirective(d)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "cgogen: %v\n", err)
+				usage()
+				os.Exit(2)
+			}
+			cfg.Cgo = append(cfg.Cgo, f)
+		}
+		packages = []*PackageConfig{cfg}
 	}
-	err = generateCgo([]string{"VG/vgu.h"}, "vgu", "../golang-openvg/vgu/vgu.go", &VGUNamer{typedefs: make(map[string]string)})
-	if err != nil {
-		panic(err)
+
+	for _, p := range packages {
+		if err := p.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "cgogen: %v\n", err)
+			if manifestPath == "" {
+				usage()
+			}
+			os.Exit(2)
+		}
+	}
+
+	failed := false
+	for _, p := range packages {
+		files, err := generateCgo(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cgogen: %s: %v\n", p.Output, err)
+			failed = true
+			continue
+		}
+		for _, f := range files {
+			if !check {
+				if err := writeOutput(f); err != nil {
+					fmt.Fprintf(os.Stderr, "cgogen: %v\n", err)
+					failed = true
+				}
+				continue
+			}
+			diff, err := checkOutput(f)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "cgogen: %v\n", err)
+				failed = true
+			} else if diff != "" {
+				fmt.Print(diff)
+				fmt.Fprintf(os.Stderr, "cgogen: %s is out of date\n", f.Path)
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parsedPackage is a package of openvg.json with the functions of its
+// headers by C name.
+type parsedPackage struct {
+	cfg       *PackageConfig
+	namer     Namer
+	functions map[string]Function
+}
+
+var parsedPackages = make(map[string]*parsedPackage)
+
+// parsePackage parses the headers of the package named pkg in openvg.json
+// for the default architecture.
+func parsePackage(t *testing.T, pkg string) *parsedPackage {
+	t.Helper()
+	if p, ok := parsedPackages[pkg]; ok {
+		return p
+	}
+	m, err := LoadManifest("openvg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range m.Packages {
+		if cfg.Package != pkg {
+			continue
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("%s: %v", pkg, err)
+		}
+		namer := NewRuleNamer(cfg)
+		h, err := parseHeaders(cfg, defaultArch, namer)
+		if err != nil {
+			t.Fatalf("%s: %v", pkg, err)
+		}
+		p := &parsedPackage{cfg, namer, make(map[string]Function, len(h.functions))}
+		for _, f := range h.functions {
+			p.functions[f.CName()] = f
+		}
+		parsedPackages[pkg] = p
+		return p
+	}
+	t.Fatalf("no package %s in openvg.json", pkg)
+	return nil
+}
+
+// function returns the function named name of the package.
+func (p *parsedPackage) function(t *testing.T, name string) Function {
+	t.Helper()
+	f, ok := p.functions[name]
+	if !ok {
+		t.Fatalf("no function %s in package %s", name, p.cfg.Package)
+	}
+	return f
+}
+
+// sourceConfig returns a package with the naming of OpenVG for the C source
+// src, which may include the system headers.
+func sourceConfig(t *testing.T, src string) *PackageConfig {
+	t.Helper()
+	header := filepath.Join(t.TempDir(), "vendor.h")
+	if err := os.WriteFile(header, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return &PackageConfig{
+		Headers:         []string{header},
+		Package:         "vendor",
+		Output:          "vendor.go",
+		Arches:          []string{defaultArch},
+		Naming:          NamingFor("VG"),
+		IncludeFiles:    []string{header},
+		SysIncludePaths: []string{"/usr/include", "/usr/include/x86_64-linux-gnu"},
+	}
+}
+
+// parseSource parses the C source src as the header of sourceConfig.
+func parseSource(t *testing.T, src string) (*headerDecls, Namer) {
+	t.Helper()
+	cfg := sourceConfig(t, src)
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	namer := NewRuleNamer(cfg)
+	h, err := parseHeaders(cfg, defaultArch, namer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, namer
+}
+
+func TestGenerateCgoArches(t *testing.T) {
+	m, err := LoadManifest("openvg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := m.Packages[0]
+	cfg.Arches = []string{"amd64", "arm64"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := generateCgo(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// OpenVG is the same on both, so there are no files of an architecture:
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, "_amd64.go") || strings.HasSuffix(f.Path, "_arm64.go") {
+			t.Errorf("generated %s for no declarations", f.Path)
+		}
+	}
+}
+
+func TestGenerateCgoImportTypes(t *testing.T) {
+	m, err := LoadManifest("openvg.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		pkg  string
+		want []string
+	}{
+		{"vgu", []string{
+			`"github.com/JamesDunne/golang-openvg/vg"`,
+			"func Line(\n\tpath vg.Path,\n\tx0 vg.Float,",
+			"closed vg.BooleanEnum,",
+		}},
+		{"vgext", []string{
+			`"github.com/JamesDunne/golang-openvg/vgu"`,
+			"(vgu.ErrorCodeEnum, error)",
+		}},
+	} {
+		var cfg *PackageConfig
+		for _, p := range m.Packages {
+			if p.Package == test.pkg {
+				cfg = p
+			}
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("%s: %v", test.pkg, err)
+		}
+		files, err := generateCgo(cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", test.pkg, err)
+		}
+		var src strings.Builder
+		for _, f := range files {
+			src.Write(f.Data)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(src.String(), want) {
+				t.Errorf("%s: no %q in the generated code", test.pkg, want)
+			}
+		}
+	}
+
+	// The types are only imported from packages of the manifest:
+	cfg := m.Packages[1]
+	cfg.ImportTypes = []TypeImport{{Package: "vgu2", Path: "example.com/vgu2"}}
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("imported the types of an unknown package")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Naming holds the rules for every kind of Go name the generator emits.
+type Naming struct {
+	Consts    NamingRules `json:"consts"`
+	Types     NamingRules `json:"types"`
+	Enums     NamingRules `json:"enums"`
+	Members   NamingRules `json:"members"`
+	Fields    NamingRules `json:"fields"`
+	Functions NamingRules `json:"functions"`
+	Params    NamingRules `json:"params"`
+}
+
+// NamingFor derives the usual Khronos-style naming from a single symbol
+// prefix, e.g. "VG" maps VGPath, VGPaintMode, VG_FILL_PATH, VG_MAXINT and
+// vgDrawPath to Path, PaintModeEnum, FillPath, Maxint and DrawPath.
+func NamingFor(prefix string) Naming {
+	n := Naming{
+		Consts:    NamingRules{Case: "camel"},
+		Types:     NamingRules{Case: "title"},
+		Enums:     NamingRules{Case: "title", Suffix: "Enum"},
+		Members:   NamingRules{Case: "camel"},
+		Fields:    NamingRules{Case: "title"},
+		Functions: NamingRules{Case: "title"},
+	}
+	if prefix != "" {
+		n.Consts.TrimPrefix = []string{prefix + "_"}
+		n.Types.TrimPrefix = []string{prefix}
+		n.Enums.TrimPrefix = []string{prefix}
+		n.Members.TrimPrefix = []string{prefix + "_"}
+		n.Functions.TrimPrefix = []string{strings.ToLower(prefix)}
+	}
+	return n
+}
+
+func (n *Naming) compile() error {
+	for _, r := range []*NamingRules{&n.Consts, &n.Types, &n.Enums, &n.Members, &n.Fields, &n.Functions, &n.Params} {
+		if err := r.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NamingRules turns a C identifier into a Go name. Overrides win outright;
+// otherwise the first matching prefix and suffix are trimmed, rewrites are
+// applied in order, the case transform runs and Prefix and Suffix are added.
+type NamingRules struct {
+	Override   map[string]string `json:"override"`
+	TrimPrefix []string          `json:"trim_prefix"`
+	TrimSuffix []string          `json:"trim_suffix"`
+	Rewrite    []Rewrite         `json:"rewrite"`
+	Case       string            `json:"case"` // "", "title", "camel" or "lower"
+	Prefix     string            `json:"prefix"`
+	Suffix     string            `json:"suffix"`
+}
+
+// Rewrite is a regular expression replacement, Replace may refer to
+// submatches as in regexp.Regexp.ReplaceAllString.
+type Rewrite struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+func (r *NamingRules) compile() error {
+	switch r.Case {
+	case "", "title", "camel", "lower":
+	default:
+		return fmt.Errorf("unknown case transform %q", r.Case)
+	}
+	for i := range r.Rewrite {
+		re, err := regexp.Compile(r.Rewrite[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("bad rewrite pattern %q: %v", r.Rewrite[i].Pattern, err)
+		}
+		r.Rewrite[i].re = re
+	}
+	return nil
+}
+
+func (r *NamingRules) Apply(name string) string {
+	if goName, ok := r.Override[name]; ok {
+		return goName
+	}
+	for _, p := range r.TrimPrefix {
+		if strings.HasPrefix(name, p) && len(name) > len(p) {
+			name = name[len(p):]
+			break
+		}
+	}
+	for _, s := range r.TrimSuffix {
+		if strings.HasSuffix(name, s) && len(name) > len(s) {
+			name = name[:len(name)-len(s)]
+			break
+		}
+	}
+	for _, rw := range r.Rewrite {
+		name = rw.re.ReplaceAllString(name, rw.Replace)
+	}
+	switch r.Case {
+	case "title":
+		name = Export(name)
+	case "camel":
+		parts := strings.Split(name, "_")
+		name = ""
+		for _, p := range parts {
+			name += strings.Title(strings.ToLower(p))
+		}
+	case "lower":
+		if name != "" {
+			name = strings.ToLower(name[:1]) + name[1:]
+		}
+	}
+	return blessName([]byte(r.Prefix + name + r.Suffix))
+}
+
+// RuleNamer names Go declarations according to the package's naming rules
+// and filters declarations by name globs and the files they are in.
+type RuleNamer struct {
+	naming       Naming
+	include      []string
+	exclude      []string
+	includeFiles []string
+	excludeFiles []string
+	typedefs     map[string]string
+	// indirections counts the pointer levels of pointer typedefs.
+	indirections map[string]int
+}
+
+func NewRuleNamer(cfg *PackageConfig) *RuleNamer {
+	return &RuleNamer{
+		naming:       cfg.Naming,
+		include:      cfg.Include,
+		exclude:      cfg.Exclude,
+		includeFiles: cfg.IncludeFiles,
+		excludeFiles: cfg.ExcludeFiles,
+		typedefs:     make(map[string]string),
+		indirections: make(map[string]int),
+	}
+}
+
+func (n *RuleNamer) RegisterTypedefEnum(identifier string) {
+	n.typedefs[identifier] = n.EnumName(Enum{identifier: identifier})
+}
+func (n *RuleNamer) RegisterTypedef(identifier string) {
+	n.typedefs[identifier] = n.TypedefName(Typedef{identifier: identifier})
+}
+func (n *RuleNamer) RegisterStructTag(tag, identifier string) {
+	if _, ok := n.typedefs["struct "+tag]; !ok {
+		n.typedefs["struct "+tag] = n.typedefs[identifier]
+	}
+}
+func (n *RuleNamer) RegisterImportedTypedef(identifier, goName string) {
+	n.typedefs[identifier] = goName
+}
+func (n *RuleNamer) RegisterIndirections(identifier string, indirections int) {
+	if indirections > 0 {
+		n.indirections[identifier] = indirections
+	}
+}
+func (n *RuleNamer) TypedefGoName(identifier string) string {
+	name, _ := n.typedefs[identifier]
+	return name
+}
+func (n *RuleNamer) TypedefIndirections(identifier string) int {
+	return n.indirections[identifier]
+}
+
+func (n *RuleNamer) ignore(name string) bool {
+	if len(n.include) > 0 && !matchAny(n.include, name) {
+		return true
+	}
+	return matchAny(n.exclude, name)
+}
+
+func (n *RuleNamer) IgnoreFile(filename string) bool {
+	if len(n.includeFiles) > 0 && !matchFile(n.includeFiles, filename) {
+		return true
+	}
+	return matchFile(n.excludeFiles, filename)
+}
+
+func (n *RuleNamer) IgnoreConst(name string) bool {
+	return n.ignore(name)
+}
+func (n *RuleNamer) IgnoreTypedef(name string) bool {
+	return n.ignore(name)
+}
+func (n *RuleNamer) IgnoreEnum(name string) bool {
+	return n.ignore(name)
+}
+func (n *RuleNamer) IgnoreFunction(name string) bool {
+	return n.ignore(name)
+}
+func (n *RuleNamer) ConstName(c Const) string {
+	return n.naming.Consts.Apply(c.identifier)
+}
+func (n *RuleNamer) TypedefName(t Typedef) string {
+	return n.naming.Types.Apply(t.identifier)
+}
+func (n *RuleNamer) FieldName(f StructField) string {
+	return n.naming.Fields.Apply(f.identifier)
+}
+func (n *RuleNamer) EnumName(e Enum) string {
+	return n.naming.Enums.Apply(e.identifier)
+}
+func (n *RuleNamer) EnumMemberName(m EnumMember) string {
+	return n.naming.Members.Apply(m.identifier)
+}
+func (n *RuleNamer) FunctionName(f Function) string {
+	return n.naming.Functions.Apply(f.identifier)
+}
+func (n *RuleNamer) ParameterName(p Parameter) string {
+	return n.naming.Params.Apply(p.identifier)
+}
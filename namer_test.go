@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestNamingRulesApply(t *testing.T) {
+	vg := NamingFor("VG")
+	for _, test := range []struct {
+		rules      NamingRules
+		name, want string
+	}{
+		{vg.Types, "VGPath", "Path"},
+		{vg.Enums, "VGPaintMode", "PaintModeEnum"},
+		{vg.Members, "VG_FILL_PATH", "FillPath"},
+		{vg.Consts, "VG_MAXINT", "Maxint"},
+		{vg.Functions, "vgDrawPath", "DrawPath"},
+		// A prefix is kept if nothing would be left:
+		{vg.Types, "VG", "VG"},
+		{NamingRules{TrimPrefix: []string{"vgu", "vg"}}, "vguLine", "Line"},
+		{NamingRules{TrimSuffix: []string{"KHR"}, Case: "title"}, "vguGradientGlowKHR", "VguGradientGlow"},
+		{NamingRules{Override: map[string]string{"VG_MAXINT": "MaxInt"}, Case: "camel"}, "VG_MAXINT", "MaxInt"},
+		{NamingRules{Rewrite: []Rewrite{{Pattern: "Khr$", Replace: "KHR"}}, Case: "title"}, "gradientGlowKhr", "GradientGlowKHR"},
+		{NamingRules{Prefix: "C", Suffix: "T"}, "float", "CfloatT"},
+		{NamingRules{}, "type", "_type"},
+	} {
+		rules := test.rules
+		if err := rules.compile(); err != nil {
+			t.Fatal(err)
+		}
+		if got := rules.Apply(test.name); got != test.want {
+			t.Errorf("Apply(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNamingRulesCompile(t *testing.T) {
+	for _, rules := range []NamingRules{
+		{Case: "upper"},
+		{Rewrite: []Rewrite{{Pattern: "("}}},
+	} {
+		if err := rules.compile(); err == nil {
+			t.Errorf("compile(%+v) succeeded", rules)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OutputFile is a generated Go file held in memory until it is written.
+type OutputFile struct {
+	Path string
+	Data []byte
+}
+
+// importPaths maps the package names generated code may refer to onto
+// their import paths.
+var importPaths = map[string]string{
+	"cgo":     "runtime/cgo",
+	"fmt":     "fmt",
+	"log":     "log",
+	"strconv": "strconv",
+	"strings": "strings",
+	"sync":    "sync",
+	"unsafe":  "unsafe",
+}
+
+// outputPath names the sibling of outPath holding the declarations of an
+// extension, of a debug build, the Go functions exported to C and those
+// specific to goarch, e.g. vgext.go becomes
+// vgext_vg_khr_egl_image_export_arm.go and vg.go becomes vg_debug.go.
+// Exported functions need a file of their own, as cgo allows no C
+// definitions in the preamble of files exporting functions.
+func outputPath(outPath, extension, build string, export bool, goarch string) string {
+	path := strings.TrimSuffix(outPath, ".go")
+	if extension != "" {
+		path += "_" + strings.ToLower(extension)
+	}
+	if build != "" {
+		path += "_" + build
+	}
+	if export {
+		path += "_export"
+	}
+	if goarch != "" {
+		path += "_" + goarch
+	}
+	return path + ".go"
+}
+
+// renderGoFile renders decls together with the cgo preamble and the imports
+// they use, guarded by the buildConstraint expression unless it is empty.
+// The result is gofmt-clean.
+func renderGoFile(cfg *PackageConfig, buildConstraint string, decls []Decl) ([]byte, error) {
+	header := &bytes.Buffer{}
+	fmt.Fprintf(header, "// Code generated by cgogen. DO NOT EDIT.\n\n")
+	if buildConstraint != "" {
+		fmt.Fprintf(header, "//go:build %s\n\n", buildConstraint)
+	}
+	fmt.Fprintf(header, "package %s\n\n", cfg.Package)
+	for _, d := range cfg.cgoDirectives() {
+		fmt.Fprintf(header, "//#cgo %s\n", d)
+	}
+	for _, inc := range cfg.preambleIncludes() {
+		fmt.Fprintf(header, "//#include %s\n", inc)
+	}
+	// Declarations may each include the headers and declare the C functions
+	// they need:
+	declared := make(map[string]bool)
+	for _, inc := range cfg.preambleIncludes() {
+		declared["#include "+inc] = true
+	}
+	for _, d := range decls {
+		for _, line := range strings.Split(strings.TrimSuffix(d.Preamble, "\n"), "\n") {
+			if line == "" || declared[line] {
+				continue
+			}
+			if isPreambleDecl(line) {
+				declared[line] = true
+			}
+			fmt.Fprintf(header, "//%s\n", line)
+		}
+	}
+	fmt.Fprintln(header, `import "C"`)
+
+	body := &bytes.Buffer{}
+	for _, d := range decls {
+		fmt.Fprintln(body)
+		fmt.Fprint(body, d.Source)
+	}
+
+	packages := make(map[string]string, len(importPaths)+len(cfg.ImportTypes))
+	for name, path := range importPaths {
+		packages[name] = path
+	}
+	for _, imp := range cfg.ImportTypes {
+		packages[imp.Package] = imp.Path
+	}
+	imports, err := usedImports(append(header.Bytes(), body.Bytes()...), packages)
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go code: %v", err)
+	}
+
+	src := &bytes.Buffer{}
+	src.Write(header.Bytes())
+	if len(imports) > 0 {
+		fmt.Fprintln(src, "\nimport (")
+		for i, path := range imports {
+			// The standard library comes first, apart from other packages:
+			if i > 0 && !isStdImport(path) && isStdImport(imports[i-1]) {
+				fmt.Fprintln(src)
+			}
+			fmt.Fprintf(src, "\t%q\n", path)
+		}
+		fmt.Fprintln(src, ")")
+	}
+	src.Write(body.Bytes())
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid Go code: %v", err)
+	}
+	return out, nil
+}
+
+// isPreambleDecl reports whether the preamble line is a whole declaration,
+// such as an #include, a prototype or a single line definition, which is
+// only written once to a file.
+func isPreambleDecl(line string) bool {
+	switch {
+	case strings.HasPrefix(line, "#include "):
+		return true
+	case line != strings.TrimLeft(line, " \t"):
+		return false
+	}
+	return strings.HasSuffix(line, ";") || strings.Contains(line, "{") && strings.HasSuffix(line, "}")
+}
+
+// usedImports returns the sorted import paths of the packages src refers to
+// without importing them, looked up by name in packages.
+func usedImports(src []byte, packages map[string]string) ([]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		// Unresolved identifiers are package names:
+		if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+			if path, ok := packages[id.Name]; ok {
+				used[path] = true
+			}
+		}
+		return true
+	})
+
+	paths := make([]string, 0, len(used))
+	for path := range used {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if isStdImport(paths[i]) != isStdImport(paths[j]) {
+			return isStdImport(paths[i])
+		}
+		return paths[i] < paths[j]
+	})
+	return paths, nil
+}
+
+// isStdImport reports whether path is a package of the standard library,
+// whose first element has no dot unlike a domain.
+func isStdImport(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+// checkOutput compares f with the file on disk and returns a unified diff if
+// the file is missing or stale.
+func checkOutput(f OutputFile) (string, error) {
+	current, err := os.ReadFile(f.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return unifiedDiff(f.Path, f.Path+" (generated)", current, f.Data), nil
+}
+
+// writeOutput replaces the file at f.Path atomically, so that it is never
+// left truncated or half written.
+func writeOutput(f OutputFile) error {
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), "."+filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(f.Data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.Path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/cznic/cc"
+)
+
+// OutRule makes the pointer parameters matching the Param glob of the
+// functions matching Function output parameters, which the wrapper returns
+// instead of taking them. Length is the number of elements of an array
+// output, such as the 3x3 matrix of vgGetMatrix, and -1 keeps parameters
+// inputs which would be guessed to be outputs.
+type OutRule struct {
+	Function string `json:"function"`
+	Param    string `json:"param"`
+	Length   int    `json:"length"`
+}
+
+// outParam is a pointer parameter returned by the wrapper, an array of
+// length elements unless length is 0.
+type outParam struct {
+	index  int
+	length int
+}
+
+// isScalar reports whether t is an arithmetic or enum type.
+func isScalar(t Type) bool {
+	switch t.Kind() {
+	case cc.Float, cc.Double, cc.LongDouble, cc.Bool, cc.Enum:
+		return true
+	}
+	return isCount(t)
+}
+
+// isOut reports whether a parameter of type t can be an output parameter,
+// that is whether it points to a single arithmetic or enum value.
+func isOut(t Type, namer Namer) bool {
+	if t.Kind() != cc.Ptr || t.typedefName(namer) != "" {
+		return false
+	}
+	return isScalar(Type{t.Element()})
+}
+
+// outParams returns the output parameters of f from the rules or, with
+// heuristics, the non-const pointers to scalars. The pointers of the slice
+// pairs are no output parameters.
+func outParams(f Function, namer Namer, rules []OutRule, heuristics bool, slices []slicePair) []outParam {
+	taken := make(map[int]bool)
+	for _, pair := range slices {
+		taken[pair.pointer] = true
+	}
+	var outs []outParam
+	for _, r := range rules {
+		if ok, _ := path.Match(r.Function, f.CName()); !ok {
+			continue
+		}
+		for i, p := range f.Parameters {
+			if ok, _ := path.Match(r.Param, p.CName()); !ok || taken[i] {
+				continue
+			}
+			taken[i] = true
+			if r.Length >= 0 && isOut(p.Type, namer) {
+				outs = append(outs, outParam{i, r.Length})
+			}
+		}
+	}
+	if heuristics {
+		for i, p := range f.Parameters {
+			if !taken[i] && isOut(p.Type, namer) && !(Type{p.Type.Element()}).IsConst() {
+				outs = append(outs, outParam{i, 0})
+			}
+		}
+	}
+	sort.Slice(outs, func(i, j int) bool { return outs[i].index < outs[j].index })
+	return outs
+}
+
+// bindOuts lets w return the output parameters outs rather than take them.
+func bindOuts(w *wrapper, f Function, namer Namer, outs []outParam) {
+	for _, o := range outs {
+		i, p := o.index, f.Parameters[o.index]
+		elem := Type{p.Type.Element()}
+		// The result is named after the parameter, the C variable is not:
+		name := namer.ParameterName(p)
+		out := name + "Out"
+		w.dropParam(i)
+
+		if o.length == 0 {
+			w.setup = append(w.setup, fmt.Sprintf("var %s %s", out, elem.CGoType(namer)))
+			w.args[i] = "&" + out
+			w.addResult(wrapperResult{
+				name:   name,
+				goType: elem.GoType(namer),
+				zero:   zeroValue(elem, namer),
+				expr:   goResult(out, elem, namer),
+			})
+			continue
+		}
+		goType := fmt.Sprintf("[%d]%s", o.length, elem.GoType(namer))
+		w.setup = append(w.setup, fmt.Sprintf("var %s [%d]%s", out, o.length, elem.CGoType(namer)))
+		w.args[i] = fmt.Sprintf("&%s[0]", out)
+		w.addResult(wrapperResult{
+			name:   name,
+			goType: goType,
+			zero:   goType + "{}",
+			expr:   fmt.Sprintf("*(*%s)(unsafe.Pointer(&%s))", goType, out),
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOutParams(t *testing.T) {
+	for _, test := range []struct {
+		pkg, function string
+		want          []outParam
+	}{
+		// Rules:
+		{"vg", "vgGetMatrix", []outParam{{0, 9}}},
+		{"vgu", "vguComputeWarpQuadToSquare", []outParam{{8, 9}}},
+		// Heuristics:
+		{"vg", "vgPathBounds", []outParam{{1, 0}, {2, 0}, {3, 0}, {4, 0}}},
+		{"vg", "vgPointAlongPath", []outParam{{4, 0}, {5, 0}, {6, 0}, {7, 0}}},
+		{"vgext", "vguTransformClipLineNDS", []outParam{{5, 0}, {6, 0}, {7, 0}}},
+		// Inputs and slices are no outputs:
+		{"vg", "vgMultMatrix", nil},
+		{"vg", "vgGetParameterfv", nil},
+		{"vg", "vgSetfv", nil},
+	} {
+		p := parsePackage(t, test.pkg)
+		f := p.function(t, test.function)
+		slices := slicePairs(f, p.namer, p.cfg.Slices, p.cfg.SliceHeuristics)
+		got := outParams(f, p.namer, p.cfg.OutParams, p.cfg.OutHeuristics, slices)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("outParams(%s) = %v, want %v", test.function, got, test.want)
+		}
+	}
+}
+
+func TestBindOutsResultNames(t *testing.T) {
+	for _, test := range []struct {
+		pkg, function, want string
+	}{
+		{"vg", "vgPathBounds", ") (minX Float, minY Float, width Float, height Float) {"},
+		{"vg", "vgGetMatrix", ") (m [9]Float) {"},
+		// The result of the C call is no parameter:
+		{"vgext", "vguTransformClipLineNDS", ") (Aout vg.Float, Bout vg.Float, Cout vg.Float, _ vgu.ErrorCodeEnum) {"},
+	} {
+		p := parsePackage(t, test.pkg)
+		f := p.function(t, test.function)
+		slices := slicePairs(f, p.namer, p.cfg.Slices, p.cfg.SliceHeuristics)
+		w := newWrapper(f, p.namer)
+		bindOuts(w, f, p.namer, outParams(f, p.namer, p.cfg.OutParams, p.cfg.OutHeuristics, slices))
+		buf := &bytes.Buffer{}
+		w.emit(buf)
+		if !strings.Contains(buf.String(), test.want) {
+			t.Errorf("%s: no %q in\n%s", test.function, test.want, buf)
+		}
+	}
+}
@@ -50,7 +50,7 @@ var basePredefines = `
 #define __STDC_VERSION__ 199901L
 #define __STDC__ 1
 #define __GNUC__ 4
-#define __GNUC_PREREQ(x,y) 0
+#define __GNUC_PREREQ(maj, min) 0
 #define __POSIX_C_DEPRECATED(ver)
 
 #define __FLT_MIN__ 0
@@ -108,6 +108,24 @@ var arches = map[string]TargetArch{
 	"sparc64":     Arch64,
 }
 
+// archAliases maps the names of the arches table which are no GOARCH to the
+// GOARCH they stand for in file names and build constraints.
+var archAliases = map[string]string{
+	"aarch64":     "arm64",
+	"armv7a":      "arm",
+	"armv8a":      "arm64",
+	"armeabi-v7a": "arm",
+	"armeabi-v8a": "arm64",
+}
+
+// goarchOf returns the GOARCH of the target architecture arch.
+func goarchOf(arch string) string {
+	if goarch, ok := archAliases[arch]; ok {
+		return goarch
+	}
+	return arch
+}
+
 var model32 = &cc.Model{
 	Items: map[cc.Kind]cc.ModelItem{
 		cc.Ptr:               {4, 4, 4, "__TODO_PTR"},
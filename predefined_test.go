@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseSystemHeaders(t *testing.T) {
+	if _, err := os.Stat("/usr/include/stdint.h"); err != nil {
+		t.Skip("no system headers")
+	}
+	h, _ := parseSource(t, `#include <stdint.h>
+
+typedef uint32_t VGuint;
+typedef int64_t VGlong;
+
+VGuint vgSize(VGlong n);
+`)
+	if len(h.functions) != 1 || h.functions[0].CName() != "vgSize" {
+		t.Errorf("got functions %v, want vgSize", h.functions)
+	}
+}
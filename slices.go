@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cznic/cc"
+)
+
+// SliceRule makes the pointer parameters matching the Pointer glob of the
+// functions matching Function take Go slices, whose length is passed as the
+// Count parameter. Stride is the number of elements per counted item, e.g.
+// 2 for the points of vguPolygon.
+type SliceRule struct {
+	Function string `json:"function"`
+	Pointer  string `json:"pointer"`
+	Count    string `json:"count"`
+	Stride   int    `json:"stride"`
+}
+
+// slicePair is a pointer parameter taking a slice and its count parameter.
+type slicePair struct {
+	pointer, count int
+	stride         int
+}
+
+// isCountName reports whether a parameter name suggests an element count,
+// like count, n, numSegments or glyphCount.
+func isCountName(name string) bool {
+	return name == "count" || name == "n" ||
+		(strings.HasPrefix(name, "num") && len(name) > 3) ||
+		strings.HasSuffix(name, "Count") || strings.HasSuffix(name, "_count")
+}
+
+// isSliceable reports whether a parameter of type t can take a Go slice,
+// that is whether it points to data rather than being a handle, callback or
+// untyped buffer.
+func isSliceable(t Type, namer Namer) bool {
+	if t.Kind() != cc.Ptr || t.typedefName(namer) != "" {
+		return false
+	}
+	switch t.Element().Kind() {
+	case cc.Void, cc.Function, cc.Ptr, cc.Undefined:
+		return false
+	}
+	return true
+}
+
+// isCount reports whether a parameter of type t can pass a slice length.
+func isCount(t Type) bool {
+	switch t.Kind() {
+	case cc.Char, cc.SChar, cc.UChar, cc.Short, cc.UShort, cc.Int, cc.UInt,
+		cc.Long, cc.ULong, cc.LongLong, cc.ULongLong:
+		return true
+	}
+	return false
+}
+
+// slicePairs returns the pointer and count parameters of f that are passed
+// as Go slices, from the rules or, with heuristics, from a count parameter
+// named like one right next to a pointer parameter.
+func slicePairs(f Function, namer Namer, rules []SliceRule, heuristics bool) []slicePair {
+	index := make(map[string]int, len(f.Parameters))
+	for i, p := range f.Parameters {
+		index[p.CName()] = i
+	}
+	var pairs []slicePair
+	taken := make(map[int]bool)
+	for _, r := range rules {
+		if ok, _ := path.Match(r.Function, f.CName()); !ok {
+			continue
+		}
+		count, ok := index[r.Count]
+		if !ok || !isCount(f.Parameters[count].Type) {
+			continue
+		}
+		stride := r.Stride
+		if stride < 1 {
+			stride = 1
+		}
+		for ptr, p := range f.Parameters {
+			if ok, _ := path.Match(r.Pointer, p.CName()); ok && !taken[ptr] && isSliceable(p.Type, namer) {
+				pairs = append(pairs, slicePair{ptr, count, stride})
+				taken[ptr], taken[count] = true, true
+			}
+		}
+	}
+	if heuristics {
+		pairs = append(pairs, guessSlicePairs(f, namer, taken)...)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].pointer < pairs[j].pointer })
+	return pairs
+}
+
+// guessSlicePairs returns the pointer parameters of f right next to an
+// integer parameter named like a count, skipping the parameters taken
+// already.
+func guessSlicePairs(f Function, namer Namer, taken map[int]bool) []slicePair {
+	var pairs []slicePair
+	for i, p := range f.Parameters {
+		if taken[i] || !isCountName(p.CName()) || !isCount(p.Type) {
+			continue
+		}
+		for _, ptr := range []int{i + 1, i - 1} {
+			if ptr < 0 || ptr >= len(f.Parameters) || taken[ptr] {
+				continue
+			}
+			if isSliceable(f.Parameters[ptr].Type, namer) {
+				pairs = append(pairs, slicePair{ptr, i, 1})
+				taken[ptr], taken[i] = true, true
+				break
+			}
+		}
+	}
+	return pairs
+}
+
+// bindSlices lets w take Go slices for the pointer parameters of the pairs
+// and pass their length as the count. Empty slices pass NULL. The first
+// slice of a count in parameter order determines it, further ones must be
+// empty or at least as long.
+func bindSlices(w *wrapper, f Function, namer Namer, pairs []slicePair) {
+	counted := make(map[int]string)
+	for _, pair := range pairs {
+		p := f.Parameters[pair.pointer]
+		elem := Type{p.Type.Element()}
+		name := namer.ParameterName(p)
+		ptr := name + "Ptr"
+
+		if wp := w.param(pair.pointer); wp != nil {
+			wp.goType = "[]" + elem.GoType(namer)
+		}
+		w.args[pair.pointer] = ptr
+
+		setup := &strings.Builder{}
+		fmt.Fprintf(setup, "var %s %s\n", ptr, p.Type.CGoType(namer))
+		fmt.Fprintf(setup, "if len(%s) > 0 {\n", name)
+		fmt.Fprintf(setup, "\t%s = (%s)(unsafe.Pointer(&%s[0]))\n", ptr, p.Type.CGoType(namer), name)
+		fmt.Fprintf(setup, "}")
+		w.setup = append(w.setup, setup.String())
+
+		length := fmt.Sprintf("len(%s)", name)
+		if pair.stride > 1 {
+			length = fmt.Sprintf("len(%s)/%d", name, pair.stride)
+		}
+		if first, ok := counted[pair.count]; ok {
+			w.setup = append(w.setup, fmt.Sprintf("if len(%s) > 0 && %s < %s {\n\tpanic(\"%s: %s is shorter than %s\")\n}",
+				name, length, first, w.name, name, first))
+			continue
+		}
+		counted[pair.count] = length
+		w.dropParam(pair.count)
+		w.args[pair.count] = fmt.Sprintf("(%s)(%s)", f.Parameters[pair.count].Type.CGoType(namer), length)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlicePairs(t *testing.T) {
+	for _, test := range []struct {
+		pkg, function string
+		want          []slicePair
+	}{
+		// Rules:
+		{"vg", "vgDrawGlyphs", []slicePair{{2, 1, 1}, {3, 1, 1}, {4, 1, 1}}},
+		{"vgu", "vguPolygon", []slicePair{{1, 2, 2}}},
+		{"vgext", "vguGradientGlowKHR", []slicePair{{11, 10, 5}}},
+		// Heuristics, with the count before the pointer:
+		{"vg", "vgSetfv", []slicePair{{2, 1, 1}}},
+		{"vg", "vgGetParameterfv", []slicePair{{3, 2, 1}}},
+		{"vg", "vgAppendPathData", []slicePair{{2, 1, 1}}},
+		// Untyped buffers and handles take no slices:
+		{"vg", "vgModifyPathCoords", nil},
+		{"vg", "vgPointAlongPath", nil},
+		{"vg", "vgGetMatrix", nil},
+	} {
+		p := parsePackage(t, test.pkg)
+		f := p.function(t, test.function)
+		got := slicePairs(f, p.namer, p.cfg.Slices, p.cfg.SliceHeuristics)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("slicePairs(%s) = %v, want %v", test.function, got, test.want)
+		}
+	}
+}
+
+func TestIsCountName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"count":       true,
+		"n":           true,
+		"numSegments": true,
+		"glyphCount":  true,
+		"stop_count":  true,
+		"num":         false,
+		"account":     false,
+		"width":       false,
+	} {
+		if got := isCountName(name); got != want {
+			t.Errorf("isCountName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
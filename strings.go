@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/cznic/cc"
+)
+
+// stringsPreamble declares the free the wrappers release C strings with.
+const stringsPreamble = "#include <stdlib.h>\n"
+
+// isString reports whether t is a const pointer to characters as used for
+// NUL-terminated strings, like the const VGubyte * of vgGetString.
+func isString(t Type, namer Namer) bool {
+	if t.Kind() != cc.Ptr || t.typedefName(namer) != "" {
+		return false
+	}
+	elem := Type{t.Element()}
+	switch elem.Kind() {
+	case cc.Char, cc.SChar, cc.UChar:
+		return elem.IsConst()
+	}
+	return false
+}
+
+// bindStrings lets w take Go strings for the string parameters of f and
+// return a Go string for its string result, except for those matching the
+// raw "function.parameter" and "function.return" globs, which may not be
+// NUL-terminated. It reports whether w allocates C strings, which need
+// stringsPreamble.
+func bindStrings(w *wrapper, f Function, namer Namer, raw []string) bool {
+	isRaw := func(name string) bool {
+		for _, pattern := range raw {
+			if ok, _ := path.Match(pattern, f.CName()+"."+name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	allocates := false
+	for i, p := range f.Parameters {
+		// Parameters taken as slices or returned already keep their types:
+		wp := w.param(i)
+		if wp == nil || wp.goType != p.Type.GoType(namer) || !isString(p.Type, namer) || isRaw(p.CName()) {
+			continue
+		}
+		name := namer.ParameterName(p)
+		str := name + "Str"
+		wp.goType = "string"
+		w.setup = append(w.setup, fmt.Sprintf("%s := C.CString(%s)\ndefer C.free(unsafe.Pointer(%s))", str, name, str))
+		w.args[i] = fmt.Sprintf("(%s)(unsafe.Pointer(%s))", p.Type.CGoType(namer), str)
+		allocates = true
+	}
+
+	if r := w.retResult(); r != nil && isString(f.ResultType, namer) && !isRaw(flagResult) {
+		r.goType = "string"
+		r.zero = `""`
+		r.expr = "C.GoString((*C.char)(unsafe.Pointer(ret)))"
+	}
+	return allocates
+}
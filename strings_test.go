@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestIsString(t *testing.T) {
+	p := parsePackage(t, "vg")
+	for _, test := range []struct {
+		function, param string // param "" is the result
+		want            bool
+	}{
+		{"vgGetString", "", true},
+		// Lookup tables look like strings, see TestBindStringsRaw:
+		{"vgLookup", "redLUT", true},
+		{"vgAppendPathData", "pathSegments", true},
+		{"vgAppendPathData", "pathData", false},
+		{"vgLookupSingle", "lookupTable", false},
+		{"vgGetMatrix", "m", false},
+		{"vgGetString", "name", false},
+	} {
+		f := p.function(t, test.function)
+		typ := f.ResultType
+		if test.param != "" {
+			found := false
+			for _, param := range f.Parameters {
+				if param.CName() == test.param {
+					typ, found = param.Type, true
+				}
+			}
+			if !found {
+				t.Fatalf("no parameter %s of %s", test.param, test.function)
+			}
+		}
+		if got := isString(typ, p.namer); got != test.want {
+			t.Errorf("isString(%s.%s) = %v, want %v", test.function, test.param, got, test.want)
+		}
+	}
+}
+
+func TestBindStringsRaw(t *testing.T) {
+	p := parsePackage(t, "vg")
+
+	f := p.function(t, "vgLookup")
+	w := newWrapper(f, p.namer)
+	if bindStrings(w, f, p.namer, p.cfg.RawStrings) {
+		t.Errorf("bindStrings(vgLookup) allocates C strings")
+	}
+	for _, wp := range w.params {
+		if wp.goType == "string" {
+			t.Errorf("vgLookup takes %s as a string", wp.name)
+		}
+	}
+
+	f = p.function(t, "vgGetString")
+	w = newWrapper(f, p.namer)
+	bindStrings(w, f, p.namer, p.cfg.RawStrings)
+	if r := w.retResult(); r == nil || r.goType != "string" {
+		t.Errorf("vgGetString does not return a string")
+	}
+}
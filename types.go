@@ -3,7 +3,12 @@ package main
 
 import (
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io"
+	"math"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/cznic/cc"
@@ -12,10 +17,25 @@ import (
 
 type Namer interface {
 	RegisterTypedefEnum(identifier string)
+	RegisterTypedef(identifier string)
+	// RegisterStructTag makes the struct tag name the Go type of the struct
+	// typedef identifier, which must be registered already.
+	RegisterStructTag(tag, identifier string)
+	// RegisterImportedTypedef makes goName, a qualified type of another
+	// package such as "vg.Path", the Go type of the typedef identifier.
+	RegisterImportedTypedef(identifier, goName string)
+	RegisterIndirections(identifier string, indirections int)
 	TypedefGoName(identifier string) string
+	TypedefIndirections(identifier string) int
 
+	IgnoreConst(name string) bool
+	IgnoreTypedef(name string) bool
 	IgnoreEnum(name string) bool
 	IgnoreFunction(name string) bool
+	IgnoreFile(filename string) bool
+	ConstName(c Const) string
+	TypedefName(t Typedef) string
+	FieldName(f StructField) string
 	EnumName(e Enum) string
 	EnumMemberName(m EnumMember) string
 	FunctionName(f Function) string
@@ -35,7 +55,11 @@ func (t Type) IsConst() bool {
 }
 
 func (t Type) IsTypeDef() bool {
-	rawSpec := t.Declarator().RawSpecifier()
+	d := t.Declarator()
+	if d == nil {
+		return false
+	}
+	rawSpec := d.RawSpecifier()
 	if name := rawSpec.TypedefName(); name > 0 {
 		return true
 	} else if rawSpec.IsTypedef() {
@@ -44,89 +68,115 @@ func (t Type) IsTypeDef() bool {
 	return false
 }
 
-func (t Type) RequiresCast() bool {
-	if t.IsTypeDef() {
-		return true
+// typedefName returns the typedef t is declared with, or "" if t is not
+// declared with a typedef or is derived from it by pointer or array
+// declarators, like the parameter type of vgSetfv(..., const VGfloat *).
+func (t Type) typedefName(namer Namer) string {
+	name := typedefNameOf(t.Type)
+	if name == "" || indirections(t.Type) != namer.TypedefIndirections(name) {
+		return ""
+	}
+	return name
+}
+
+// indirections counts the pointer and array levels of t.
+func indirections(t cc.Type) int {
+	n := 0
+	for t.Kind() == cc.Ptr || t.Kind() == cc.Array {
+		t = t.Element()
+		n++
+	}
+	return n
+}
+
+func (t Type) GoType(namer Namer) string {
+	if name := t.typedefName(namer); name != "" {
+		if goName := namer.TypedefGoName(name); goName != "" {
+			return goName
+		}
+	}
+
+	if t.Kind() == cc.Ptr && (t.Element().Kind() == cc.Void || t.Element().Kind() == cc.Function) {
+		return "unsafe.Pointer"
 	}
 
 	switch t.Kind() {
 	case cc.Undefined:
-		return false
+		return "undefined"
 	case cc.Void:
-		return false
+		return "byte"
 	case cc.Ptr:
-		return Type{t.Element()}.RequiresCast()
+		return "*" + Type{t.Element()}.GoType(namer)
 	case cc.UintPtr: // Type used for pointer arithmetic.
-		return false
+		return "uintptr"
 	case cc.Char:
-		return false
+		return "int8"
 	case cc.SChar:
-		return false
+		return "int8"
 	case cc.UChar:
-		return false
+		return "uint8"
 	case cc.Short:
-		return false
+		return "int16"
 	case cc.UShort:
-		return false
+		return "uint16"
 	case cc.Int:
-		return false
+		return "int32"
 	case cc.UInt:
-		return false
+		return "uint32"
 	case cc.Long:
-		return false
+		return sizedIntType(t, true)
 	case cc.ULong:
-		return false
+		return sizedIntType(t, false)
 	case cc.LongLong:
-		return false
+		return "int64"
 	case cc.ULongLong:
-		return false
+		return "uint64"
 	case cc.Float:
-		return false
+		return "float32"
 	case cc.Double:
-		return false
+		return "float64"
 	case cc.LongDouble:
-		return false
+		return "float64"
 	case cc.Bool:
-		return false
+		return "bool"
 	case cc.FloatComplex:
-		return false
+		return "complex64"
 	case cc.DoubleComplex:
-		return false
+		return "complex128"
 	case cc.LongDoubleComplex:
-		return false
+		return "complex128"
 	case cc.Struct:
-		return true
+		// Structs declared by tag are the Go types of their typedef, or the
+		// cgo types of their tag if there is none:
+		if tag := tagOf(t); tag != "" {
+			if goName := namer.TypedefGoName("struct " + tag); goName != "" {
+				return goName
+			}
+			return "C.struct_" + tag
+		}
+		return "struct"
 	case cc.Union:
-		return true
+		return fmt.Sprintf("[%d]byte", t.SizeOf())
 	case cc.Enum:
-		return true
+		// Enums that are not generated decay to their integer type:
+		return sizedIntType(t, true)
 	case cc.TypedefName:
-		return true
+		if goName := namer.TypedefGoName(typedefNameOf(t)); goName != "" {
+			return goName
+		}
+		return "???"
 	case cc.Function:
-		return true
+		return "func"
 	case cc.Array:
-		return Type{t.Element()}.RequiresCast()
+		return fmt.Sprintf("[%d]%s", t.Elements(), Type{t.Element()}.GoType(namer))
 	default:
-		return false
+		return "???"
 	}
 }
 
-func (t Type) GoType(namer Namer) string {
-	rawSpec := t.Declarator().RawSpecifier()
-	if name := rawSpec.TypedefName(); name > 0 {
-		typedefName := blessName(xc.Dict.S(name))
-		if goName := namer.TypedefGoName(typedefName); goName != "" {
-			return goName
-		}
-	} else if rawSpec.IsTypedef() {
-		typedefName := identifierOf(t.Declarator().DirectDeclarator)
-		if goName := namer.TypedefGoName(typedefName); goName != "" {
-			return goName
-		}
-	}
-
-	if t.Kind() == cc.Ptr && t.Element().Kind() == cc.Void {
-		return "unsafe.Pointer"
+func (t Type) CGoType(namer Namer) string {
+	if name := t.typedefName(namer); name != "" {
+		return "C." + name
 	}
 
 	switch t.Kind() {
@@ -135,140 +185,160 @@ func (t Type) GoType(namer Namer) string {
 	case cc.Void:
 		return "byte"
 	case cc.Ptr:
-		return "*" + Type{t.Element()}.GoType(namer)
+		switch t.Element().Kind() {
+		case cc.Void:
+			return "unsafe.Pointer"
+		case cc.Function:
+			return "*[0]byte"
+		}
+		return "*" + Type{t.Element()}.CGoType(namer)
 	case cc.UintPtr: // Type used for pointer arithmetic.
-		return "uintptr"
+		return "C.uintptr_t"
 	case cc.Char:
-		return "int8"
+		return "C.char"
 	case cc.SChar:
-		return "int8"
+		return "C.schar"
 	case cc.UChar:
-		return "uint8"
+		return "C.uchar"
 	case cc.Short:
-		return "int16"
+		return "C.short"
 	case cc.UShort:
-		return "uint16"
+		return "C.ushort"
 	case cc.Int:
-		return "int32"
+		return "C.int"
 	case cc.UInt:
-		return "uint32"
+		return "C.uint"
 	case cc.Long:
-		return "int32"
+		return "C.long"
 	case cc.ULong:
-		return "uint32"
+		return "C.ulong"
 	case cc.LongLong:
-		return "int64"
+		return "C.longlong"
 	case cc.ULongLong:
-		return "uint64"
+		return "C.ulonglong"
 	case cc.Float:
-		return "float32"
+		return "C.float"
 	case cc.Double:
-		return "float64"
+		return "C.double"
 	case cc.LongDouble:
-		return "float64"
+		return "C.double"
 	case cc.Bool:
-		return "bool"
+		return "C._Bool"
 	case cc.FloatComplex:
-		return "complex64"
+		return "C.complexfloat"
 	case cc.DoubleComplex:
-		return "complex128"
+		return "C.complexdouble"
 	case cc.LongDoubleComplex:
-		return "complex128"
+		return "C.complexdouble"
 	case cc.Struct:
+		if tag := tagOf(t); tag != "" {
+			return "C.struct_" + tag
+		}
 		return "struct"
 	case cc.Union:
-		return "union"
+		return fmt.Sprintf("[%d]byte", t.SizeOf())
 	case cc.Enum:
-		return namer.EnumName(Enum{identifier: typedefNameOf(t)})
+		return fmt.Sprintf("C.%s", typedefNameOf(t))
 	case cc.TypedefName:
-		// TODO
-		return namer.EnumName(Enum{identifier: typedefNameOf(t)})
+		return fmt.Sprintf("C.%s", typedefNameOf(t))
 	case cc.Function:
 		return "func"
 	case cc.Array:
-		return fmt.Sprintf("[%d]%s", t.Elements(), Type{t.Element()}.GoType(namer))
+		return fmt.Sprintf("[%d]%s", t.Elements(), Type{t.Element()}.CGoType(namer))
 	default:
 		return "???"
 	}
 }
 
-func (t Type) CGoType() string {
-	prefix := ""
-	base := ""
+// cgoArg converts the Go expression expr of type t for passing to C.
+func cgoArg(expr string, t Type, namer Namer) string {
+	cType := t.CGoType(namer)
+	switch t.Kind() {
+	case cc.Array:
+		return fmt.Sprintf("(*%s)(unsafe.Pointer(&%s[0]))", Type{t.Element()}.CGoType(namer), expr)
+	case cc.Ptr:
+		if cType == "unsafe.Pointer" {
+			return expr
+		}
+		return fmt.Sprintf("(%s)(unsafe.Pointer(%s))", cType, expr)
+	case cc.Struct, cc.Union:
+		return fmt.Sprintf("*(*%s)(unsafe.Pointer(&%s))", cType, expr)
+	}
+	return fmt.Sprintf("(%s)(%s)", cType, expr)
+}
 
-	if t.Kind() == cc.Array {
-		prefix = fmt.Sprintf("[%d]", t.Elements())
-		t = Type{t.Element()}
-	} else if t.Kind() == cc.Ptr {
-		prefix = "*"
-		t = Type{t.Element()}
+// goResult converts the C expression expr of type t to its Go type. Struct
+// and union results must be addressable.
+func goResult(expr string, t Type, namer Namer) string {
+	goType := t.GoType(namer)
+	switch t.Kind() {
+	case cc.Ptr:
+		if goType == "unsafe.Pointer" {
+			return expr
+		}
+		return fmt.Sprintf("(%s)(unsafe.Pointer(%s))", goType, expr)
+	case cc.Struct, cc.Union:
+		return fmt.Sprintf("*(*%s)(unsafe.Pointer(&%s))", goType, expr)
 	}
+	return fmt.Sprintf("(%s)(%s)", goType, expr)
+}
 
-	rawSpec := t.Declarator().RawSpecifier()
-	if name := rawSpec.TypedefName(); name > 0 {
-		base = "C." + blessName(xc.Dict.S(name))
-	} else if rawSpec.IsTypedef() {
-		base = "C." + identifierOf(t.Declarator().DirectDeclarator)
-	} else {
-		switch t.Kind() {
-		case cc.Undefined:
-			base = "undefined"
-		case cc.Void:
-			base = "byte"
-		case cc.UintPtr: // Type used for pointer arithmetic.
-			base = "uintptr"
-		case cc.Char:
-			base = "int8"
-		case cc.SChar:
-			base = "int8"
-		case cc.UChar:
-			base = "uint8"
-		case cc.Short:
-			base = "int16"
-		case cc.UShort:
-			base = "uint16"
-		case cc.Int:
-			base = "int32"
-		case cc.UInt:
-			base = "uint32"
-		case cc.Long:
-			base = "int32"
-		case cc.ULong:
-			base = "uint32"
-		case cc.LongLong:
-			base = "int64"
-		case cc.ULongLong:
-			base = "uint64"
-		case cc.Float:
-			base = "float32"
-		case cc.Double:
-			base = "float64"
-		case cc.LongDouble:
-			base = "float64"
-		case cc.Bool:
-			base = "bool"
-		case cc.FloatComplex:
-			base = "complex64"
-		case cc.DoubleComplex:
-			base = "complex128"
-		case cc.LongDoubleComplex:
-			base = "complex128"
-		case cc.Struct:
-			base = "struct"
-		case cc.Union:
-			base = "union"
-		case cc.Enum:
-			base = fmt.Sprintf("C.%s", typedefNameOf(t))
-		case cc.TypedefName:
-			base = fmt.Sprintf("C.%s", typedefNameOf(t))
-		case cc.Function:
-			base = "func"
-		default:
-			base = "???"
+// CType spells t as a C declaration specifier, "" if it can not be spelled
+// without a typedef. Arrays decay to pointers as in parameter lists.
+func (t Type) CType(namer Namer) string {
+	if name := t.typedefName(namer); name != "" {
+		return name
+	}
+
+	switch t.Kind() {
+	case cc.Ptr, cc.Array:
+		if elem := (Type{t.Element()}).CType(namer); elem != "" {
+			return elem + " *"
 		}
+		return ""
+	case cc.Void:
+		return "void"
+	case cc.Char:
+		return "char"
+	case cc.SChar:
+		return "signed char"
+	case cc.UChar:
+		return "unsigned char"
+	case cc.Short:
+		return "short"
+	case cc.UShort:
+		return "unsigned short"
+	case cc.Int:
+		return "int"
+	case cc.UInt:
+		return "unsigned int"
+	case cc.Long:
+		return "long"
+	case cc.ULong:
+		return "unsigned long"
+	case cc.LongLong:
+		return "long long"
+	case cc.ULongLong:
+		return "unsigned long long"
+	case cc.Float:
+		return "float"
+	case cc.Double:
+		return "double"
+	case cc.LongDouble:
+		return "long double"
+	case cc.Bool:
+		return "_Bool"
+	default:
+		return ""
 	}
+}
 
-	return prefix + base
+// sizedIntType returns the Go integer type as wide as t in the active model.
+func sizedIntType(t Type, signed bool) string {
+	if signed {
+		return fmt.Sprintf("int%d", t.SizeOf()*8)
+	}
+	return fmt.Sprintf("uint%d", t.SizeOf()*8)
 }
 
 type Parameter struct {
@@ -286,6 +356,26 @@ type Function struct {
 
 func (f Function) CName() string { return f.identifier }
 
+// checkTypes reports an error unless every parameter and the result of f
+// have a Go type, which anonymous structs, for one, do not.
+func (f Function) checkTypes(namer Namer) error {
+	for _, p := range f.Parameters {
+		for _, goType := range []string{p.Type.GoType(namer), p.Type.CGoType(namer)} {
+			if _, err := parser.ParseExpr(goType); err != nil {
+				return fmt.Errorf("parameter %s of type %s has no Go type", p.CName(), p.Type)
+			}
+		}
+	}
+	if f.ResultType.Kind() != cc.Void {
+		for _, goType := range []string{f.ResultType.GoType(namer), f.ResultType.CGoType(namer)} {
+			if _, err := parser.ParseExpr(goType); err != nil {
+				return fmt.Errorf("result of type %s has no Go type", f.ResultType)
+			}
+		}
+	}
+	return nil
+}
+
 func parseFunction(fnDecl *cc.Declarator) Function {
 	fn := fnDecl.DirectDeclarator
 
@@ -314,48 +404,380 @@ func parseFunction(fnDecl *cc.Declarator) Function {
 	return f
 }
 
-func emitFunction(f Function, o io.Writer, namer Namer) {
-	// Function declaration:
-	fmt.Fprintf(o, "func %s(\n", namer.FunctionName(f))
-	for _, p := range f.Parameters {
-		fmt.Fprintf(o, "\t%s %s,\n", namer.ParameterName(p), p.Type.GoType(namer))
+func emitFunction(w *wrapper, o io.Writer) {
+	w.emit(o)
+}
+
+type Const struct {
+	identifier string
+	// typedef is the C typedef the constant is cast to, "" if it is untyped.
+	typedef string
+	Value   interface{}
+}
+
+func (c Const) CName() string { return c.identifier }
+
+// parseConst evaluates an object-like macro. It reports false unless the
+// macro expands to an integer, floating point or string constant, which may
+// refer to the other macros. A cast of an integer to one of the typedefs,
+// such as ((VGHandle)0), makes a constant of the typedef.
+func parseConst(m *cc.Macro, macros map[int]*cc.Macro, typedefs map[string]bool) (Const, bool) {
+	if m.IsFnLike {
+		return Const{}, false
 	}
-	if f.ResultType.Kind() == cc.Void {
-		fmt.Fprintf(o, ")")
-	} else {
-		fmt.Fprintf(o, ") %s", f.ResultType.GoType(namer))
+	c := Const{
+		identifier: blessName(m.DefTok.S()),
+		Value:      m.Value,
+	}
+	toks := m.ReplacementToks()
+	// cc evaluates macros like #if expressions, which take identifiers such
+	// as the typedef of a cast or the extern of VG_API_CALL for 0:
+	if typedef, operand, ok := typedefCast(toks, typedefs); ok {
+		v, ok := intLiteral(operand)
+		if !ok {
+			return Const{}, false
+		}
+		c.typedef, c.Value = typedef, v
+		return c, true
+	}
+	if len(toks) == 0 {
+		return Const{}, false
+	}
+	for _, t := range toks {
+		if t.Rune == cc.IDENTIFIER && macros[t.Val] == nil {
+			return Const{}, false
+		}
 	}
 
-	// Function body:
-	fmt.Fprintf(o, " {\n")
-	fmt.Fprintf(o, "\t")
-	if f.ResultType.Kind() != cc.Void {
-		fmt.Fprintf(o, "ret := ")
+	switch v := m.Value.(type) {
+	case int32, int64, uint32, uint64:
+	case float32:
+		if math.IsInf(float64(v), 0) || math.IsNaN(float64(v)) {
+			return Const{}, false
+		}
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return Const{}, false
+		}
+	case cc.StringLitID:
+		c.Value = string(xc.Dict.S(int(v)))
+	case cc.LongStringLitID:
+		c.Value = string(xc.Dict.S(int(v)))
+	default:
+		return Const{}, false
 	}
-	fmt.Fprintf(o, "C.%s(\n", f.CName())
-	for _, p := range f.Parameters {
-		expr := namer.ParameterName(p)
-		if p.Type.RequiresCast() {
-			if p.Type.Kind() == cc.Array {
-				expr = fmt.Sprintf("(*%s)(&%s[0])", Type{p.Type.Element()}.CGoType(), expr)
-			} else {
-				expr = fmt.Sprintf("(%s)(%s)", p.Type.CGoType(), expr)
+	return c, true
+}
+
+// typedefCast splits toks like ((VGHandle)0) into the typedef cast to and
+// the operand of the cast.
+func typedefCast(toks []xc.Token, typedefs map[string]bool) (string, []xc.Token, bool) {
+	toks = trimParens(toks)
+	if len(toks) < 4 || toks[0].Rune != '(' || toks[1].Rune != cc.IDENTIFIER || toks[2].Rune != ')' {
+		return "", nil, false
+	}
+	typedef := string(toks[1].S())
+	if !typedefs[typedef] {
+		return "", nil, false
+	}
+	return typedef, toks[3:], true
+}
+
+// trimParens strips the parentheses enclosing all of toks.
+func trimParens(toks []xc.Token) []xc.Token {
+	for len(toks) > 2 && toks[0].Rune == '(' && toks[len(toks)-1].Rune == ')' {
+		depth := 0
+		for _, t := range toks[:len(toks)-1] {
+			switch t.Rune {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 {
+				// The first parenthesis closes before the end, as in (a)(b):
+				return toks
 			}
 		}
-		if p.Type.Kind() == cc.Ptr && !p.Type.IsTypeDef() {
-			expr = fmt.Sprintf("unsafe.Pointer(%s)", expr)
+		toks = toks[1 : len(toks)-1]
+	}
+	return toks
+}
+
+// intLiteral returns the value of toks if they are a non-negative integer
+// constant, in parentheses or not.
+func intLiteral(toks []xc.Token) (uint64, bool) {
+	toks = trimParens(toks)
+	if len(toks) != 1 || toks[0].Rune != cc.INTCONST {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(strings.TrimRight(string(toks[0].S()), "uUlL"), 0, 64)
+	return v, err == nil
+}
+
+func emitConst(c Const, o io.Writer, namer Namer) {
+	var value string
+	switch v := c.Value.(type) {
+	case string:
+		value = strconv.Quote(v)
+	case float32:
+		value = floatLiteral(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case float64:
+		value = floatLiteral(strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		value = fmt.Sprint(v)
+	}
+
+	if goName := namer.TypedefGoName(c.typedef); c.typedef != "" && goName != "" {
+		fmt.Fprintf(o, "const %s %s = %s\n", namer.ConstName(c), goName, value)
+	} else {
+		fmt.Fprintf(o, "const %s = %s\n", namer.ConstName(c), value)
+	}
+}
+
+// floatLiteral keeps untyped floating point constants such as 1.0 from
+// turning into integer constants.
+func floatLiteral(s string) string {
+	if strings.ContainsAny(s, ".e") {
+		return s
+	}
+	return s + ".0"
+}
+
+// Typedef is a typedef of anything but an enum, emitted as a Go named type.
+type Typedef struct {
+	identifier string
+	Type       Type
+
+	// underlying is the Go type the named type is defined as, it is resolved
+	// before the typedef itself is registered with the namer.
+	underlying string
+	// alias is set for further typedefs of an enum, which share its type.
+	alias bool
+}
+
+func (t Typedef) CName() string { return t.identifier }
+
+func parseTypedef(tdDecl *cc.Declarator) Typedef {
+	return Typedef{
+		identifier: identifierOf(tdDecl.DirectDeclarator),
+		Type:       Type{tdDecl.Type},
+	}
+}
+
+func emitTypedef(t Typedef, o io.Writer, namer Namer) {
+	if t.alias {
+		fmt.Fprintf(o, "type %s = %s\n", namer.TypedefName(t), t.underlying)
+		return
+	}
+	fmt.Fprintf(o, "type %s %s\n", namer.TypedefName(t), t.underlying)
+}
+
+// Struct is a struct typedef, mirrored by a Go struct with the same layout.
+type Struct struct {
+	identifier string
+	Type       Type
+	Fields     []StructField
+
+	// Opaque structs are only known by name and have no fields.
+	Opaque bool
+}
+
+// StructField is a named member of a struct; bit fields, anonymous members
+// and members of unsupported types are turned into padding.
+type StructField struct {
+	identifier string
+	Type       Type
+	Offset     int
+}
+
+func (s Struct) CName() string { return s.identifier }
+
+func (f StructField) CName() string { return f.identifier }
+
+func parseStruct(sDecl *cc.Declarator) Struct {
+	s := Struct{
+		identifier: identifierOf(sDecl.DirectDeclarator),
+		Type:       Type{sDecl.Type},
+	}
+	s.Fields, s.Opaque = parseFields(sDecl.Type)
+	return s
+}
+
+// parseFields returns the named members of a struct or union type, true if
+// the type is incomplete.
+func parseFields(t cc.Type) ([]StructField, bool) {
+	members, incomplete := t.Members()
+	if incomplete {
+		return nil, true
+	}
+	fields := make([]StructField, 0, len(members))
+	for _, m := range members {
+		if m.Name == 0 || m.Bits > 0 {
+			continue
 		}
-		fmt.Fprintf(o, "\t\t%s,\n", expr)
+		fields = append(fields, StructField{
+			identifier: blessName(xc.Dict.S(m.Name)),
+			Type:       Type{m.Type},
+			Offset:     m.OffsetOf,
+		})
 	}
-	fmt.Fprintf(o, "\t)\n")
-	if f.ResultType.Kind() != cc.Void {
-		if f.ResultType.RequiresCast() {
-			fmt.Fprintf(o, "\treturn (%s)(ret)\n", f.ResultType.GoType(namer))
-		} else {
-			fmt.Fprintf(o, "\treturn ret\n")
+	return fields, false
+}
+
+// fieldGoType returns the Go type of a struct field, false if the field can
+// not be represented in Go.
+func (t Type) fieldGoType(namer Namer) (string, bool) {
+	if name := t.typedefName(namer); name != "" && namer.TypedefGoName(name) != "" {
+		return namer.TypedefGoName(name), true
+	}
+
+	switch t.Kind() {
+	case cc.Struct, cc.Union, cc.Function, cc.Undefined:
+		return "", false
+	case cc.Ptr:
+		if t.Element().Kind() == cc.Void {
+			return "unsafe.Pointer", true
+		}
+		if elem, ok := (Type{t.Element()}).fieldGoType(namer); ok {
+			return "*" + elem, true
+		}
+		return "unsafe.Pointer", true
+	case cc.Array:
+		if elem, ok := (Type{t.Element()}).fieldGoType(namer); ok {
+			return fmt.Sprintf("[%d]%s", t.Elements(), elem), true
+		}
+		return "", false
+	}
+	return t.GoType(namer), true
+}
+
+func emitStruct(s Struct, o io.Writer, namer Namer) {
+	goName := namer.TypedefName(Typedef{identifier: s.identifier})
+	if s.Opaque {
+		fmt.Fprintf(o, "type %s struct{}\n", goName)
+		return
+	}
+
+	// Fields the Go struct can not represent are covered by padding, which
+	// is also inserted wherever the C compiler aligns the next field:
+	fields := make([]StructField, 0, len(s.Fields))
+	fmt.Fprintf(o, "type %s struct {\n", goName)
+	offset := 0
+	for _, f := range s.Fields {
+		goType, ok := f.Type.fieldGoType(namer)
+		if !ok || f.Offset < offset {
+			continue
+		}
+		if f.Offset > offset {
+			fmt.Fprintf(o, "\t_ [%d]byte\n", f.Offset-offset)
+		}
+		fmt.Fprintf(o, "\t%s %s\n", namer.FieldName(f), goType)
+		fields = append(fields, f)
+		offset = f.Offset + f.Type.SizeOf()
+	}
+	if size := s.Type.SizeOf(); size > offset {
+		fmt.Fprintf(o, "\t_ [%d]byte\n", size-offset)
+	}
+	fmt.Fprintf(o, "}\n")
+
+	fmt.Fprintf(o, "// Fail to compile unless %s has the layout of C.%s:\n", goName, s.identifier)
+	fmt.Fprintf(o, "const (\n")
+	fmt.Fprintf(o, "\t_ = -(unsafe.Sizeof(%s{}) - uintptr(C.sizeof_%s))\n", goName, s.identifier)
+	fmt.Fprintf(o, "\t_ = -(unsafe.Alignof(%s{}) - unsafe.Alignof(C.%s{}))\n", goName, s.identifier)
+	for _, f := range fields {
+		fmt.Fprintf(o, "\t_ = -(unsafe.Offsetof(%s{}.%s) - unsafe.Offsetof(C.%s{}.%s))\n",
+			goName, namer.FieldName(f), s.identifier, f.identifier)
+	}
+	fmt.Fprintf(o, ")\n")
+}
+
+// Union is a union typedef, mirrored by a Go type backed by a byte array as
+// large and aligned as the union with an accessor pair per member.
+type Union struct {
+	identifier string
+	Type       Type
+	Members    []StructField
+
+	// Opaque unions are only known by name and have no members.
+	Opaque bool
+}
+
+func (u Union) CName() string { return u.identifier }
+
+func parseUnion(uDecl *cc.Declarator) Union {
+	u := Union{
+		identifier: identifierOf(uDecl.DirectDeclarator),
+		Type:       Type{uDecl.Type},
+	}
+	u.Members, u.Opaque = parseFields(uDecl.Type)
+	return u
+}
+
+// alignOf returns the alignment of t, assuming the usual ABIs where scalars
+// are aligned to their size.
+func alignOf(t cc.Type) int {
+	switch t.Kind() {
+	case cc.Array:
+		return alignOf(t.Element())
+	case cc.Struct, cc.Union:
+		align := 1
+		members, _ := t.Members()
+		for _, m := range members {
+			if a := alignOf(m.Type); a > align {
+				align = a
+			}
 		}
+		return align
+	}
+	if size := t.SizeOf(); size > 0 && size <= 8 {
+		return size
 	}
+	return 8
+}
+
+func emitUnion(u Union, o io.Writer, namer Namer) {
+	goName := namer.TypedefName(Typedef{identifier: u.identifier})
+	if u.Opaque {
+		fmt.Fprintf(o, "type %s struct{}\n", goName)
+		return
+	}
+
+	fmt.Fprintf(o, "type %s struct {\n", goName)
+	fmt.Fprintf(o, "\t_   [0]uint%d\n", alignOf(u.Type.Type)*8)
+	fmt.Fprintf(o, "\traw [%d]byte\n", u.Type.SizeOf())
 	fmt.Fprintf(o, "}\n")
+
+	// cgo represents unions as byte arrays, so only the size can be checked:
+	fmt.Fprintf(o, "// Fail to compile unless %s is as large as C.%s:\n", goName, u.identifier)
+	fmt.Fprintf(o, "const _ = -(unsafe.Sizeof(%s{}) - uintptr(C.sizeof_%s))\n", goName, u.identifier)
+
+	for _, m := range u.Members {
+		goType, ok := m.Type.fieldGoType(namer)
+		if !ok {
+			continue
+		}
+		// The garbage collector does not see pointers stored in the bytes
+		// of the union, so pointer members are accessed as uintptr, which
+		// says as much, and members holding pointers otherwise are left out:
+		name := namer.FieldName(m)
+		if m.Type.Kind() == cc.Ptr {
+			goType = "uintptr"
+			fmt.Fprintf(o, "\n// %s returns the %s pointer member of the union. It is a uintptr, as\n", name, m.identifier)
+			fmt.Fprintf(o, "// the union does not keep Go memory it points to alive.\n")
+		} else if hasPointers(m.Type.Type) {
+			continue
+		} else {
+			fmt.Fprintf(o, "\n// %s returns the %s member of the union.\n", name, m.identifier)
+		}
+		fmt.Fprintf(o, "func (u *%s) %s() %s {\n", goName, name, goType)
+		fmt.Fprintf(o, "\treturn *(*%s)(unsafe.Pointer(&u.raw))\n", goType)
+		fmt.Fprintf(o, "}\n")
+		fmt.Fprintf(o, "\n// Set%s stores v in the %s member of the union.\n", name, m.identifier)
+		fmt.Fprintf(o, "func (u *%s) Set%s(v %s) {\n", goName, name, goType)
+		fmt.Fprintf(o, "\t*(*%s)(unsafe.Pointer(&u.raw)) = v\n", goType)
+		fmt.Fprintf(o, "}\n")
+	}
 }
 
 type EnumMember struct {
@@ -403,6 +825,96 @@ func emitEnum(e Enum, o io.Writer, namer Namer) {
 	fmt.Fprintf(o, ")\n")
 }
 
+// emitEnumNames writes the String method of e unless it is a set of flags,
+// a Parse function and an All function listing its values. Members with the
+// same value are aliases: String returns the name of the first one, Parse
+// accepts every name and All lists the value once. Sentinel members, such
+// as VG_PAINT_MODE_FORCE_SIZE, are skipped. With cNames the names are the C
+// identifiers of the members. Parse of a set of flags reads what String of
+// emitFlags writes, which must use the same names.
+func emitEnumNames(e Enum, o io.Writer, namer Namer, flags, cNames bool, sentinels []string) {
+	name := namer.EnumName(e)
+	type member struct {
+		goName, name string
+		alias        bool
+	}
+	var members []member
+	values := make(map[string]bool, len(e.Members))
+	for _, m := range e.Members {
+		if matchAny(sentinels, m.CName()) {
+			continue
+		}
+		mb := member{goName: namer.EnumMemberName(m), name: namer.EnumMemberName(m)}
+		if cNames {
+			mb.name = m.CName()
+		}
+		value := fmt.Sprint(m.Value)
+		mb.alias = values[value]
+		values[value] = true
+		members = append(members, mb)
+	}
+
+	if !flags {
+		fmt.Fprintf(o, "\n// String returns the name of e, or its number if it has none.\n")
+		fmt.Fprintf(o, "func (e %s) String() string {\n", name)
+		fmt.Fprintf(o, "\tswitch e {\n")
+		for _, m := range members {
+			if !m.alias {
+				fmt.Fprintf(o, "\tcase %s:\n", m.goName)
+				fmt.Fprintf(o, "\t\treturn %q\n", m.name)
+			}
+		}
+		fmt.Fprintf(o, "\t}\n")
+		fmt.Fprintf(o, "\treturn fmt.Sprintf(\"%s(%%d)\", int32(e))\n", name)
+		fmt.Fprintf(o, "}\n")
+	}
+
+	if flags {
+		fmt.Fprintf(o, "\n// Parse%s returns the %s named s, which lists flag names and a\n", name, name)
+		fmt.Fprintf(o, "// number for any other bits separated by | as String does.\n")
+		fmt.Fprintf(o, "func Parse%s(s string) (%s, error) {\n", name, name)
+		fmt.Fprintf(o, "\tvar f %s\n", name)
+		fmt.Fprintf(o, "\tfor _, part := range strings.Split(s, \"|\") {\n")
+		fmt.Fprintf(o, "\t\tswitch part {\n")
+		for _, m := range members {
+			fmt.Fprintf(o, "\t\tcase %q:\n", m.name)
+			fmt.Fprintf(o, "\t\t\tf |= %s\n", m.goName)
+		}
+		fmt.Fprintf(o, "\t\tdefault:\n")
+		fmt.Fprintf(o, "\t\t\tn, err := strconv.ParseUint(part, 0, 32)\n")
+		fmt.Fprintf(o, "\t\t\tif err != nil {\n")
+		fmt.Fprintf(o, "\t\t\t\treturn 0, fmt.Errorf(\"unknown %s %%q\", part)\n", name)
+		fmt.Fprintf(o, "\t\t\t}\n")
+		fmt.Fprintf(o, "\t\t\tf |= %s(n)\n", name)
+		fmt.Fprintf(o, "\t\t}\n")
+		fmt.Fprintf(o, "\t}\n")
+		fmt.Fprintf(o, "\treturn f, nil\n")
+		fmt.Fprintf(o, "}\n")
+	} else {
+		fmt.Fprintf(o, "\n// Parse%s returns the %s named s.\n", name, name)
+		fmt.Fprintf(o, "func Parse%s(s string) (%s, error) {\n", name, name)
+		fmt.Fprintf(o, "\tswitch s {\n")
+		for _, m := range members {
+			fmt.Fprintf(o, "\tcase %q:\n", m.name)
+			fmt.Fprintf(o, "\t\treturn %s, nil\n", m.goName)
+		}
+		fmt.Fprintf(o, "\t}\n")
+		fmt.Fprintf(o, "\treturn 0, fmt.Errorf(\"unknown %s %%q\", s)\n", name)
+		fmt.Fprintf(o, "}\n")
+	}
+
+	fmt.Fprintf(o, "\n// All%s returns every %s value.\n", name, name)
+	fmt.Fprintf(o, "func All%s() []%s {\n", name, name)
+	fmt.Fprintf(o, "\treturn []%s{\n", name)
+	for _, m := range members {
+		if !m.alias {
+			fmt.Fprintf(o, "\t\t%s,\n", m.goName)
+		}
+	}
+	fmt.Fprintf(o, "\t}\n")
+	fmt.Fprintf(o, "}\n")
+}
+
 func identifierOf(dd *cc.DirectDeclarator) string {
 	switch dd.Case {
 	case 0: // IDENTIFIER
@@ -423,8 +935,56 @@ func identifierOf(dd *cc.DirectDeclarator) string {
 	}
 }
 
+// positionOf returns the position of the identifier dd declares.
+func positionOf(dd *cc.DirectDeclarator) token.Pos {
+	switch dd.Case {
+	case 0: // IDENTIFIER
+		return dd.Token.Pos()
+	case 1: // '(' Declarator ')'
+		return positionOf(dd.Declarator.DirectDeclarator)
+	default:
+		return positionOf(dd.DirectDeclarator)
+	}
+}
+
+// fileOf returns the slash separated path of the file pos is in.
+func fileOf(pos token.Pos) string {
+	return filepath.ToSlash(filepath.Clean(xc.FileSet.Position(pos).Filename))
+}
+
+// hasPointers reports whether values of t hold pointers.
+func hasPointers(t cc.Type) bool {
+	switch t.Kind() {
+	case cc.Ptr:
+		return true
+	case cc.Array:
+		return hasPointers(t.Element())
+	case cc.Struct, cc.Union:
+		members, _ := t.Members()
+		for _, m := range members {
+			if hasPointers(m.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tagOf returns the tag of the struct, union or enum type t, "" if it has
+// none.
+func tagOf(t cc.Type) string {
+	if tag := t.Tag(); tag > 0 {
+		return string(xc.Dict.S(tag))
+	}
+	return ""
+}
+
 func typedefNameOf(typ cc.Type) string {
-	rawSpec := typ.Declarator().RawSpecifier()
+	d := typ.Declarator()
+	if d == nil {
+		return ""
+	}
+	rawSpec := d.RawSpecifier()
 	if name := rawSpec.TypedefName(); name > 0 {
 		return blessName(xc.Dict.S(name))
 	} else if rawSpec.IsTypedef() {
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"testing"
+)
+
+func TestParseConst(t *testing.T) {
+	h, namer := parseSource(t, `typedef unsigned int VGuint;
+typedef VGuint VGHandle;
+
+#define VG_API_CALL
+#define VG_API_EXIT extern
+#define VG_MAXINT 0x7FFFFFFF
+#define VG_MAX VG_MAXINT
+#define VG_SCALE 1.5f
+#define VG_VENDOR "Khronos"
+#define VG_INVALID_HANDLE ((VGHandle)0)
+#define VG_FIRST_HANDLE (VGHandle)(1u)
+#define VG_UNKNOWN VG_NOT_DEFINED
+#define VG_NEGATIVE_HANDLE ((VGHandle)-1)
+#define VG_ID(x) (x)
+`)
+	want := map[string]string{
+		"VG_MAXINT":         "const Maxint = 2147483647\n",
+		"VG_MAX":            "const Max = 2147483647\n",
+		"VG_SCALE":          "const Scale = 1.5\n",
+		"VG_VENDOR":         "const Vendor = \"Khronos\"\n",
+		"VG_INVALID_HANDLE": "const InvalidHandle Handle = 0\n",
+		"VG_FIRST_HANDLE":   "const FirstHandle Handle = 1\n",
+	}
+	buf := &bytes.Buffer{}
+	for _, c := range h.consts {
+		buf.Reset()
+		emitConst(c, buf, namer)
+		if w, ok := want[c.CName()]; !ok {
+			t.Errorf("unexpected constant %s", c.CName())
+		} else if buf.String() != w {
+			t.Errorf("%s: got %q, want %q", c.CName(), buf.String(), w)
+		}
+		delete(want, c.CName())
+	}
+	for name := range want {
+		t.Errorf("no constant %s", name)
+	}
+}
+
+func TestStructTagTypes(t *testing.T) {
+	h, namer := parseSource(t, `typedef struct tagged {
+	int x;
+	float y;
+} Tagged;
+struct opaque;
+
+void vgTakeTagged(struct tagged *t);
+void vgTakeValue(struct tagged t);
+struct tagged vgGiveTagged(void);
+void vgTakeOpaque(struct opaque *o);
+`)
+	// The mirror Tagged is converted to the struct at the call:
+	want := map[string][]string{
+		"vgTakeTagged": {"t *Tagged,", "(*C.struct_tagged)(unsafe.Pointer(t))"},
+		"vgTakeValue":  {"t Tagged,", "*(*C.struct_tagged)(unsafe.Pointer(&t))"},
+		"vgGiveTagged": {") Tagged {", "return *(*Tagged)(unsafe.Pointer(&ret))"},
+		"vgTakeOpaque": {"o *C.struct_opaque,"},
+	}
+	buf := &bytes.Buffer{}
+	for _, f := range h.functions {
+		buf.Reset()
+		emitFunction(newWrapper(f, namer), buf)
+		src, err := format.Source(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", f.CName(), err)
+		}
+		for _, w := range want[f.CName()] {
+			if !strings.Contains(string(src), w) {
+				t.Errorf("%s: got\n%s\nwant %s", f.CName(), src, w)
+			}
+		}
+	}
+}
+
+func TestTypedefDeclarators(t *testing.T) {
+	h, namer := parseSource(t, `typedef enum { VG_RED = 1, VG_GREEN = 2 } VGColor, *VGColorPtr, **VGColorList;
+typedef unsigned int VGuint, *VGuintPtr;
+typedef struct { int x; } VGPoint, *VGPointPtr;
+`)
+	want := map[string]string{
+		"VGColorPtr":  "type ColorPtr *ColorEnum\n",
+		"VGColorList": "type ColorList **ColorEnum\n",
+		"VGuint":      "type Uint uint32\n",
+		"VGuintPtr":   "type UintPtr *uint32\n",
+		"VGPointPtr":  "type PointPtr *Point\n",
+	}
+	buf := &bytes.Buffer{}
+	for _, td := range h.typedefs {
+		buf.Reset()
+		emitTypedef(td, buf, namer)
+		if w, ok := want[td.CName()]; !ok {
+			t.Errorf("unexpected typedef %s", td.CName())
+		} else if buf.String() != w {
+			t.Errorf("%s: got %q, want %q", td.CName(), buf.String(), w)
+		}
+		delete(want, td.CName())
+	}
+	for name := range want {
+		t.Errorf("no typedef %s", name)
+	}
+}
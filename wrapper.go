@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cznic/cc"
+)
+
+// wrapper is the Go function wrapping the call of a C function. Parameters
+// may be rewritten before it is emitted, e.g. to take Go callbacks.
+type wrapper struct {
+	name  string
+	cName string
+
+	params  []wrapperParam
+	setup   []string // statements before the C call
+	args    []string // C call arguments by C parameter index
+	preArgs []string // arguments passed ahead of args, e.g. to trampolines
+	check   []string // statements after the C call
+	results []wrapperResult
+
+	// hasRet is set if the C result is assigned to ret.
+	hasRet bool
+}
+
+// wrapperParam is a Go parameter and the index of the C parameter it
+// stands for.
+type wrapperParam struct {
+	name   string
+	goType string
+	index  int
+}
+
+// wrapperResult is a Go result and the expression it is returned as.
+type wrapperResult struct {
+	// name is set for the results of C parameters, which name every result.
+	name   string
+	goType string
+	zero   string
+	expr   string
+
+	// ret is set for the result of the C call.
+	ret bool
+}
+
+func newWrapper(f Function, namer Namer) *wrapper {
+	w := &wrapper{
+		name:  namer.FunctionName(f),
+		cName: f.CName(),
+	}
+	for _, p := range f.Parameters {
+		name := namer.ParameterName(p)
+		w.params = append(w.params, wrapperParam{
+			name:   name,
+			goType: p.Type.GoType(namer),
+			index:  len(w.args),
+		})
+		w.args = append(w.args, cgoArg(name, p.Type, namer))
+	}
+	if f.ResultType.Kind() != cc.Void {
+		w.hasRet = true
+		w.results = append(w.results, wrapperResult{
+			goType: f.ResultType.GoType(namer),
+			zero:   zeroValue(f.ResultType, namer),
+			expr:   goResult("ret", f.ResultType, namer),
+			ret:    true,
+		})
+	}
+	return w
+}
+
+// zeroValue returns the Go zero value of t.
+func zeroValue(t Type, namer Namer) string {
+	switch t.Kind() {
+	case cc.Ptr:
+		return "nil"
+	case cc.Struct, cc.Union:
+		return t.GoType(namer) + "{}"
+	case cc.Bool:
+		return "false"
+	}
+	return "0"
+}
+
+// param returns the Go parameter standing for the C parameter i, nil if it
+// was dropped.
+func (w *wrapper) param(i int) *wrapperParam {
+	for j := range w.params {
+		if w.params[j].index == i {
+			return &w.params[j]
+		}
+	}
+	return nil
+}
+
+// dropParam removes the Go parameter standing for the C parameter i, whose
+// argument must be set up otherwise.
+func (w *wrapper) dropParam(i int) {
+	for j := range w.params {
+		if w.params[j].index == i {
+			w.params = append(w.params[:j], w.params[j+1:]...)
+			return
+		}
+	}
+}
+
+// retResult returns the Go result of the C call, nil if there is none.
+func (w *wrapper) retResult() *wrapperResult {
+	for i := range w.results {
+		if w.results[i].ret {
+			return &w.results[i]
+		}
+	}
+	return nil
+}
+
+// addResult adds r ahead of the result of the C call, so that a status the
+// C function returns, such as an error code, comes last.
+func (w *wrapper) addResult(r wrapperResult) {
+	for i := range w.results {
+		if w.results[i].ret {
+			w.results = append(w.results[:i], append([]wrapperResult{r}, w.results[i:]...)...)
+			return
+		}
+	}
+	w.results = append(w.results, r)
+}
+
+// addError adds an error result unless w has one.
+func (w *wrapper) addError() {
+	for _, r := range w.results {
+		if r.goType == "error" {
+			return
+		}
+	}
+	w.results = append(w.results, wrapperResult{goType: "error", zero: "nil", expr: "nil"})
+}
+
+// returnErr returns the statement returning the zero values of the results
+// but the error result, which is err.
+func (w *wrapper) returnErr(err string) string {
+	exprs := make([]string, len(w.results))
+	for i, r := range w.results {
+		exprs[i] = r.zero
+		if r.goType == "error" {
+			exprs[i] = err
+		}
+	}
+	return "return " + strings.Join(exprs, ", ")
+}
+
+// resultNames returns the names of the results if any of them is named,
+// which are err for the error and blank for others, such as the result of
+// the C call assigned to ret in the body.
+func (w *wrapper) resultNames() []string {
+	named := false
+	for _, r := range w.results {
+		named = named || r.name != ""
+	}
+	if !named {
+		return nil
+	}
+	taken := make(map[string]bool, len(w.params))
+	for _, p := range w.params {
+		taken[p.name] = true
+	}
+	names := make([]string, len(w.results))
+	for i, r := range w.results {
+		switch {
+		case r.name != "":
+			names[i] = r.name
+		case r.goType == "error" && !taken["err"]:
+			names[i] = "err"
+		default:
+			names[i] = "_"
+		}
+	}
+	return names
+}
+
+func (w *wrapper) emit(o io.Writer) {
+	// Function declaration:
+	fmt.Fprintf(o, "func %s(\n", w.name)
+	for _, p := range w.params {
+		fmt.Fprintf(o, "\t%s %s,\n", p.name, p.goType)
+	}
+	names := w.resultNames()
+	switch {
+	case len(w.results) == 0:
+		fmt.Fprintf(o, ")")
+	case len(w.results) == 1 && names == nil:
+		fmt.Fprintf(o, ") %s", w.results[0].goType)
+	default:
+		types := make([]string, len(w.results))
+		for i, r := range w.results {
+			types[i] = r.goType
+			if names != nil {
+				types[i] = names[i] + " " + r.goType
+			}
+		}
+		fmt.Fprintf(o, ") (%s)", strings.Join(types, ", "))
+	}
+
+	// Function body:
+	fmt.Fprintf(o, " {\n")
+	for _, s := range w.setup {
+		fmt.Fprintf(o, "\t%s\n", strings.Replace(s, "\n", "\n\t", -1))
+	}
+	fmt.Fprintf(o, "\t")
+	if w.hasRet {
+		fmt.Fprintf(o, "ret := ")
+	}
+	fmt.Fprintf(o, "C.%s(\n", w.cName)
+	for _, args := range [][]string{w.preArgs, w.args} {
+		for _, arg := range args {
+			fmt.Fprintf(o, "\t\t%s,\n", arg)
+		}
+	}
+	fmt.Fprintf(o, "\t)\n")
+	for _, s := range w.check {
+		fmt.Fprintf(o, "\t%s\n", strings.Replace(s, "\n", "\n\t", -1))
+	}
+	if len(w.results) > 0 {
+		exprs := make([]string, len(w.results))
+		for i, r := range w.results {
+			exprs[i] = r.expr
+		}
+		fmt.Fprintf(o, "\treturn %s\n", strings.Join(exprs, ", "))
+	}
+	fmt.Fprintf(o, "}\n")
+}